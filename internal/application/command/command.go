@@ -12,6 +12,7 @@ const (
 	MOVE
 	ATTACK
 	DISCONNECT
+	CAST
 )
 
 type Command struct {
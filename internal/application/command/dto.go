@@ -1,7 +1,13 @@
 package command
 
+// RequestID is chosen by the client. When non-zero the server answers the
+// command with a result carrying the same ID. Seq numbers a client's
+// commands in the order it sent them; snapshots report the last one the
+// server processed.
 type DTO struct {
 	Type        Type                   `json:"type"`
+	RequestID   uint64                 `json:"request_id,omitempty"`
+	Seq         uint64                 `json:"seq,omitempty"`
 	CharacterID string                 `json:"character_id"`
 	Data        map[string]interface{} `json:"data"`
 }
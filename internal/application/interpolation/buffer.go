@@ -0,0 +1,163 @@
+package interpolation
+
+import (
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"sort"
+	"time"
+)
+
+const (
+	// maxBuffered bounds the snapshots kept when Sample is not called.
+	maxBuffered = 64
+	// offsetSmoothing is the weight of a new sample in the estimate of the
+	// server clock offset, so one late packet does not shift the timeline.
+	offsetSmoothing = 0.1
+)
+
+// Buffer renders the world Delay behind the server clock by interpolating
+// between the two buffered snapshots around that moment. Positions are
+// interpolated; state, health and flash change when the timeline reaches
+// the snapshot that carries them. Once the timeline passes the newest
+// snapshot, characters keep moving at their last velocity for at most
+// MaxExtrapolation and then hold still. It is not safe for concurrent use.
+type Buffer struct {
+	Delay            time.Duration
+	MaxExtrapolation time.Duration
+
+	snaps  []services.WorldSnapshot
+	offset float64
+	synced bool
+}
+
+func NewBuffer(delay, maxExtrapolation time.Duration) *Buffer {
+	return &Buffer{Delay: delay, MaxExtrapolation: maxExtrapolation}
+}
+
+// Push adds a snapshot received at the given local time. Snapshots without
+// a ServerTime or with one already buffered are ignored.
+func (b *Buffer) Push(ws services.WorldSnapshot, receivedAt time.Time) {
+	if ws.ServerTime == 0 {
+		return
+	}
+	i := sort.Search(len(b.snaps), func(i int) bool { return b.snaps[i].ServerTime >= ws.ServerTime })
+	if i < len(b.snaps) && b.snaps[i].ServerTime == ws.ServerTime {
+		return
+	}
+
+	sample := float64(ws.ServerTime - receivedAt.UnixNano())
+	if b.synced {
+		b.offset += (sample - b.offset) * offsetSmoothing
+	} else {
+		b.offset, b.synced = sample, true
+	}
+	b.snaps = append(b.snaps, services.WorldSnapshot{})
+	copy(b.snaps[i+1:], b.snaps[i:])
+	b.snaps[i] = ws
+	if len(b.snaps) > maxBuffered {
+		b.snaps = b.snaps[len(b.snaps)-maxBuffered:]
+	}
+}
+
+// Len returns the number of buffered snapshots.
+func (b *Buffer) Len() int {
+	return len(b.snaps)
+}
+
+// Sample returns the characters as they are rendered at the local time now,
+// and drops the snapshots the timeline has moved past.
+func (b *Buffer) Sample(now time.Time) []services.CharacterSnapshot {
+	if len(b.snaps) == 0 {
+		return nil
+	}
+	t := b.renderTime(now)
+
+	i := sort.Search(len(b.snaps), func(i int) bool { return b.snaps[i].ServerTime > t })
+	switch {
+	case i == 0:
+		return clone(b.snaps[0].Characters)
+	case i == len(b.snaps):
+		b.snaps = b.snaps[max(len(b.snaps)-2, 0):]
+		return b.extrapolate(t)
+	}
+	b.snaps = b.snaps[i-1:]
+	from, to := b.snaps[0], b.snaps[1]
+	f := float64(t-from.ServerTime) / float64(to.ServerTime-from.ServerTime)
+	return interpolate(from, to, f)
+}
+
+// Projectiles returns the projectiles as they are rendered at the local time
+// now. They fly in straight lines, so each one is moved along its velocity
+// from the newest snapshot the timeline has reached.
+func (b *Buffer) Projectiles(now time.Time) []services.ProjectileSnapshot {
+	if len(b.snaps) == 0 {
+		return nil
+	}
+	t := b.renderTime(now)
+	i := sort.Search(len(b.snaps), func(i int) bool { return b.snaps[i].ServerTime > t })
+	from := b.snaps[max(i-1, 0)]
+	elapsed := max(float64(t-from.ServerTime), 0) / float64(time.Second)
+	out := append([]services.ProjectileSnapshot(nil), from.Projectiles...)
+	for i := range out {
+		out[i].X += out[i].VX * elapsed
+		out[i].Y += out[i].VY * elapsed
+	}
+	return out
+}
+
+func (b *Buffer) renderTime(now time.Time) int64 {
+	return now.UnixNano() + int64(b.offset) - int64(b.Delay)
+}
+
+// extrapolate continues the motion between the last two snapshots past the
+// newest one, up to MaxExtrapolation. Only running characters keep moving.
+func (b *Buffer) extrapolate(t int64) []services.CharacterSnapshot {
+	last := b.snaps[len(b.snaps)-1]
+	out := clone(last.Characters)
+	if len(b.snaps) < 2 {
+		return out
+	}
+	prev := b.snaps[len(b.snaps)-2]
+	ahead := min(t-last.ServerTime, int64(b.MaxExtrapolation))
+	f := 1 + float64(ahead)/float64(last.ServerTime-prev.ServerTime)
+	byID := index(prev.Characters)
+	for i := range out {
+		p, ok := byID[out[i].ID]
+		if !ok || out[i].State != string(domain.StateRunning) {
+			continue
+		}
+		out[i].X = lerp(p.X, out[i].X, f)
+		out[i].Y = lerp(p.Y, out[i].Y, f)
+	}
+	return out
+}
+
+// interpolate returns the characters of from with positions moved a
+// fraction f of the way to to. Characters that to no longer has stay put.
+func interpolate(from, to services.WorldSnapshot, f float64) []services.CharacterSnapshot {
+	out := clone(from.Characters)
+	byID := index(to.Characters)
+	for i := range out {
+		if c, ok := byID[out[i].ID]; ok {
+			out[i].X = lerp(out[i].X, c.X, f)
+			out[i].Y = lerp(out[i].Y, c.Y, f)
+		}
+	}
+	return out
+}
+
+func index(cs []services.CharacterSnapshot) map[string]services.CharacterSnapshot {
+	m := make(map[string]services.CharacterSnapshot, len(cs))
+	for _, c := range cs {
+		m[c.ID] = c
+	}
+	return m
+}
+
+func clone(cs []services.CharacterSnapshot) []services.CharacterSnapshot {
+	return append([]services.CharacterSnapshot(nil), cs...)
+}
+
+func lerp(a, b, f float64) float64 {
+	return a + (b-a)*f
+}
@@ -0,0 +1,123 @@
+package prediction
+
+import (
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+)
+
+const (
+	// maxPending bounds the inputs kept for replay when the server stops
+	// acknowledging them, e.g. while the player has no character.
+	maxPending = 256
+	// maxReplayStep splits replayed time into steps no longer than a
+	// client frame, so timers expire where they did the first time.
+	maxReplayStep = 1.0 / 60
+)
+
+// Input is a MOVE command the client sent, stamped with its Seq. Duration
+// is how long it has been in effect on the client.
+type Input struct {
+	Seq      uint64
+	DX, DY   float64
+	Duration float64
+}
+
+// Predictor moves the player's own character ahead of the server with the
+// movement rules of domain.World. Reconcile resets it to each authoritative
+// snapshot and replays the inputs the snapshot does not acknowledge yet.
+// It is not safe for concurrent use.
+type Predictor struct {
+	id      string
+	world   *domain.World
+	self    domain.Character
+	pending []Input
+}
+
+func NewPredictor(id string, width, height float64) *Predictor {
+	return &Predictor{id: id, world: domain.NewWorld(width, height)}
+}
+
+// Apply records in and turns the predicted character in its direction.
+func (p *Predictor) Apply(in Input) {
+	if len(p.pending) == maxPending {
+		p.pending = append(p.pending[:0], p.pending[1:]...)
+	}
+	in.Duration = 0
+	p.pending = append(p.pending, in)
+	if p.self != nil {
+		p.self.SetDirection(in.DX, in.DY)
+	}
+}
+
+// Advance moves the predicted character dt seconds ahead.
+func (p *Predictor) Advance(dt float64) {
+	if n := len(p.pending); n > 0 {
+		p.pending[n-1].Duration += dt
+	}
+	p.world.Update(dt)
+}
+
+// Reconcile adopts the server's state of the character from ws, drops the
+// inputs it acknowledges and replays the rest on top.
+func (p *Predictor) Reconcile(ws services.WorldSnapshot) {
+	n := 0
+	for _, in := range p.pending {
+		if in.Seq > ws.LastInputSeq {
+			p.pending[n] = in
+			n++
+		}
+	}
+	p.pending = p.pending[:n]
+
+	p.self = nil
+	clear(p.world.Characters)
+	for _, c := range ws.Characters {
+		if c.ID == p.id {
+			p.self = character(c)
+			p.world.Characters[c.ID] = p.self
+			break
+		}
+	}
+	if p.self == nil {
+		return
+	}
+	for _, in := range p.pending {
+		p.self.SetDirection(in.DX, in.DY)
+		for d := in.Duration; d > 0; d -= maxReplayStep {
+			p.world.Update(min(d, maxReplayStep))
+		}
+	}
+}
+
+// Position reports where the character is predicted to be, or false before
+// a snapshot containing it arrived.
+func (p *Predictor) Position() (x, y float64, ok bool) {
+	if p.self == nil {
+		return 0, 0, false
+	}
+	x, y = p.self.Position()
+	return x, y, true
+}
+
+// Pending returns the number of inputs not yet acknowledged by the server.
+func (p *Predictor) Pending() int {
+	return len(p.pending)
+}
+
+func character(c services.CharacterSnapshot) domain.Character {
+	var ch domain.Character
+	if c.Class == "mage" {
+		ch = domain.NewMage(c.ID, c.X, c.Y)
+	} else {
+		ch = domain.NewWarrior(c.ID, c.X, c.Y)
+	}
+	state := domain.CharacterState(c.State)
+	if c.Health <= 0 {
+		state = domain.StateDying
+	}
+	ch.SetState(state)
+	for _, e := range c.Effects {
+		ch.AddEffect(domain.Effect{Kind: domain.EffectKind(e.Kind), Magnitude: e.Magnitude, Remaining: e.Remaining})
+	}
+	return ch
+}
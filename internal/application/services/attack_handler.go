@@ -1,12 +1,19 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"meatgrinder/internal/application/command"
 	"meatgrinder/internal/domain"
 )
 
+// AttackHandler starts casting an ability. ATTACK names it in "ability" or
+// uses the class's primary one; CAST must name it. Enemy abilities take the
+// ID of another character in "target_id". Cone and area abilities are
+// aimed at a point "x", "y", along a direction "dx", "dy" or at
+// "target_id"; only the direction matters for cones. Hits land, and are
+// reported as events, once the cast completes in the world update.
 type AttackHandler struct {
 	world  *domain.World
 	logger Logger
@@ -22,40 +29,134 @@ func NewAttackHandler(world *domain.World, logger Logger) *AttackHandler {
 func (h *AttackHandler) Handle(c command.Command) error {
 	attacker, ok := h.world.Characters[c.CharacterID]
 	if !ok {
-		return nil
+		return commandErrorf(CodeCharacterNotFound, "character not found")
 	}
 	if attacker.IsDead() {
-		return nil
+		return commandErrorf(CodeCharacterDead, "character is dead")
 	}
-	tid, _ := c.Data["target_id"].(string)
-	target, exist := h.world.Characters[tid]
-	if !exist || target.IsDead() {
-		return nil
+	ability, err := h.ability(attacker, c)
+	if err != nil {
+		return err
 	}
 
-	if h.getDistance(attacker, target) > attacker.AttackRadius() {
-		return nil
+	if ability.Targeting == domain.TargetCone || ability.Targeting == domain.TargetArea {
+		return h.castAt(attacker, ability, c)
 	}
 
-	attacker.Attack([]domain.Character{target})
-	h.logAttack(attacker, target)
+	var target domain.Character
+	if ability.Targeting == domain.TargetEnemy {
+		tid, ok := c.Data["target_id"].(string)
+		if !ok || tid == "" {
+			return commandErrorf(CodeInvalidArgument, "invalid target_id value")
+		}
+		if tid == c.CharacterID {
+			return commandErrorf(CodeInvalidArgument, "%s cannot target yourself", ability.Name)
+		}
+		target, ok = h.world.Characters[tid]
+		if !ok {
+			return commandErrorf(CodeTargetNotFound, "target %s not found", tid)
+		}
+		if target.IsDead() {
+			return commandErrorf(CodeTargetDead, "target %s is already dead", tid)
+		}
+		if d := domain.Distance(attacker, target); d > ability.Range {
+			return commandErrorf(CodeOutOfRange, "target %s is out of range (%.0f > %.0f)", tid, d, ability.Range)
+		}
+	}
 
+	if err := attacker.Cast(ability, target); err != nil {
+		return castError(err, attacker, ability)
+	}
+	h.logCast(attacker, ability, target)
 	return nil
 }
 
-func (h *AttackHandler) getDistance(a, t domain.Character) float64 {
-	acx, acy := a.Position()
-	tcx, tcy := t.Position()
-	return math.Hypot(tcx-acx, tcy-acy)
+func (h *AttackHandler) castAt(attacker domain.Character, ability domain.Ability, c command.Command) error {
+	x, y, err := h.aim(attacker, ability, c)
+	if err != nil {
+		return err
+	}
+	if ability.Targeting == domain.TargetArea {
+		ax, ay := attacker.Position()
+		if d := math.Hypot(x-ax, y-ay); d > ability.Range {
+			return commandErrorf(CodeOutOfRange, "point is out of range (%.0f > %.0f)", d, ability.Range)
+		}
+	}
+	if err := attacker.CastAt(ability, x, y); err != nil {
+		return castError(err, attacker, ability)
+	}
+	h.logger.LogEvent(fmt.Sprintf("%s casts %s at (%.0f, %.0f)", attacker.ID(), ability.Name, x, y))
+	return nil
+}
+
+// aim returns the point c aims at. A direction is turned into the point at
+// the ability's range.
+func (h *AttackHandler) aim(attacker domain.Character, ability domain.Ability, c command.Command) (float64, float64, error) {
+	if x, ok := c.Data["x"].(float64); ok {
+		y, ok := c.Data["y"].(float64)
+		if !ok {
+			return 0, 0, commandErrorf(CodeInvalidArgument, "invalid y value")
+		}
+		return x, y, nil
+	}
+	if dx, ok := c.Data["dx"].(float64); ok {
+		dy, ok := c.Data["dy"].(float64)
+		if !ok {
+			return 0, 0, commandErrorf(CodeInvalidArgument, "invalid dy value")
+		}
+		d := math.Hypot(dx, dy)
+		if d == 0 {
+			return 0, 0, commandErrorf(CodeInvalidArgument, "direction must not be zero")
+		}
+		ax, ay := attacker.Position()
+		return ax + dx/d*ability.Range, ay + dy/d*ability.Range, nil
+	}
+	if tid, ok := c.Data["target_id"].(string); ok && tid != "" {
+		target, ok := h.world.Characters[tid]
+		if !ok {
+			return 0, 0, commandErrorf(CodeTargetNotFound, "target %s not found", tid)
+		}
+		x, y := target.Position()
+		return x, y, nil
+	}
+	return 0, 0, commandErrorf(CodeInvalidArgument, "%s needs a point, a direction or a target_id", ability.Name)
+}
+
+func (h *AttackHandler) ability(attacker domain.Character, c command.Command) (domain.Ability, error) {
+	abilities := attacker.Abilities()
+	name, _ := c.Data["ability"].(string)
+	if name == "" {
+		if c.Type == command.CAST || len(abilities) == 0 {
+			return domain.Ability{}, commandErrorf(CodeInvalidArgument, "invalid ability value")
+		}
+		return abilities[0], nil
+	}
+	for _, a := range abilities {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+	return domain.Ability{}, commandErrorf(CodeInvalidArgument, "unknown ability %q", name)
+}
+
+func castError(err error, attacker domain.Character, a domain.Ability) error {
+	switch {
+	case errors.Is(err, domain.ErrOnCooldown):
+		return commandErrorf(CodeOnCooldown, "%s is on cooldown for %.1fs", a.Name, attacker.Cooldown(a.Name))
+	case errors.Is(err, domain.ErrNoEnergy):
+		return commandErrorf(CodeNoEnergy, "%s needs %.0f energy", a.Name, a.Cost)
+	case errors.Is(err, domain.ErrCasting):
+		return commandErrorf(CodeBusy, "already casting")
+	case errors.Is(err, domain.ErrCannotAct):
+		return commandErrorf(CodeCannotAct, "cannot act right now")
+	}
+	return err
 }
 
-func (h *AttackHandler) logAttack(attacker, target domain.Character) {
-	switch attacker.DamageType() {
-	case domain.Physical:
-		h.logger.LogEvent(fmt.Sprintf("Warrior %s attacked %s with sword", attacker.ID(), target.ID()))
-	case domain.Magical:
-		h.logger.LogEvent(fmt.Sprintf("Mage %s attacked %s with magic", attacker.ID(), target.ID()))
-	default:
-		h.logger.LogEvent(fmt.Sprintf("%s dealt damage to %s with %s", attacker.ID(), target.ID(), target.DamageType()))
+func (h *AttackHandler) logCast(attacker domain.Character, a domain.Ability, target domain.Character) {
+	if target == nil {
+		h.logger.LogEvent(fmt.Sprintf("%s casts %s", attacker.ID(), a.Name))
+		return
 	}
+	h.logger.LogEvent(fmt.Sprintf("%s casts %s at %s", attacker.ID(), a.Name, target.ID()))
 }
@@ -9,17 +9,20 @@ import (
 type DisconnectHandler struct {
 	world  *domain.World
 	logger Logger
+	events EventSink
 }
 
-func NewDisconnectHandler(w *domain.World, l Logger) *DisconnectHandler {
+func NewDisconnectHandler(w *domain.World, l Logger, events EventSink) *DisconnectHandler {
 	return &DisconnectHandler{
 		world:  w,
 		logger: l,
+		events: events,
 	}
 }
 
 func (h *DisconnectHandler) Handle(c command.Command) error {
 	delete(h.world.Characters, c.CharacterID)
 	h.logger.LogEvent(fmt.Sprintf("%s disconnected", c.CharacterID))
+	h.events.Emit(GameEvent{Type: EventDisconnected, Actor: c.CharacterID})
 	return nil
 }
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+type ErrorCode string
+
+const (
+	CodeInternal          ErrorCode = "internal"
+	CodeUnknownCommand    ErrorCode = "unknown_command"
+	CodeInvalidArgument   ErrorCode = "invalid_argument"
+	CodeCharacterNotFound ErrorCode = "character_not_found"
+	CodeCharacterDead     ErrorCode = "character_dead"
+	CodeTargetNotFound    ErrorCode = "target_not_found"
+	CodeTargetDead        ErrorCode = "target_dead"
+	CodeOutOfRange        ErrorCode = "out_of_range"
+	CodeBusy              ErrorCode = "busy"
+	CodeForbidden         ErrorCode = "forbidden"
+	CodeRateLimited       ErrorCode = "rate_limited"
+	CodeOnCooldown        ErrorCode = "on_cooldown"
+	CodeNoEnergy          ErrorCode = "not_enough_energy"
+	CodeCannotAct         ErrorCode = "cannot_act"
+)
+
+// CommandError is returned by handlers when a command is rejected. The code
+// is stable and meant for programs, the message for players.
+type CommandError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+func commandErrorf(code ErrorCode, format string, args ...interface{}) error {
+	return &CommandError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorCodeOf returns the code carried by err, or CodeInternal for errors
+// that are not CommandErrors.
+func ErrorCodeOf(err error) ErrorCode {
+	var ce *CommandError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	return CodeInternal
+}
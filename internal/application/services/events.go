@@ -0,0 +1,41 @@
+package services
+
+type EventType string
+
+const (
+	EventSpawned      EventType = "spawned"
+	EventAttacked     EventType = "attacked"
+	EventDied         EventType = "died"
+	EventDisconnected EventType = "disconnected"
+)
+
+// GameEvent is something that happened during a tick that clients may want
+// to show, e.g. in a kill feed.
+type GameEvent struct {
+	Type   EventType `json:"type"`
+	Actor  string    `json:"actor,omitempty"`
+	Target string    `json:"target,omitempty"`
+	Amount float64   `json:"amount,omitempty"`
+	// Ability names what an attacked event was dealt with.
+	Ability string `json:"ability,omitempty"`
+}
+
+type EventSink interface {
+	Emit(GameEvent)
+}
+
+// eventBuffer collects events on the game loop goroutine until they are
+// drained after the tick.
+type eventBuffer struct {
+	events []GameEvent
+}
+
+func (b *eventBuffer) Emit(e GameEvent) {
+	b.events = append(b.events, e)
+}
+
+func (b *eventBuffer) drain() []GameEvent {
+	e := b.events
+	b.events = nil
+	return e
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// Publisher receives the loop's output. Implementations must not block.
+type Publisher interface {
+	PublishSnapshot(WorldSnapshot)
+	PublishEvents([]GameEvent)
+}
+
+// GameLoop is the single goroutine allowed to touch the world: it drains
+// queued commands, advances the simulation and builds snapshots.
+type GameLoop struct {
+	game          *GameService
+	publisher     Publisher
+	tickInterval  time.Duration
+	snapshotEvery int
+}
+
+func NewGameLoop(g *GameService, p Publisher, tickRate, snapshotRate int) *GameLoop {
+	every := tickRate / snapshotRate
+	if every < 1 {
+		every = 1
+	}
+	return &GameLoop{
+		game:          g,
+		publisher:     p,
+		tickInterval:  time.Second / time.Duration(tickRate),
+		snapshotEvery: every,
+	}
+}
+
+func (l *GameLoop) Run(ctx context.Context) {
+	t := time.NewTicker(l.tickInterval)
+	defer t.Stop()
+	tick := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			tick++
+			l.game.Tick(l.tickInterval.Seconds())
+			if events := l.game.DrainEvents(); len(events) > 0 {
+				l.publisher.PublishEvents(events)
+			}
+			if tick%l.snapshotEvery == 0 {
+				l.publisher.PublishSnapshot(l.game.BuildWorldSnapshot())
+			}
+		}
+	}
+}
@@ -4,12 +4,36 @@ import (
 	"fmt"
 	"meatgrinder/internal/application/command"
 	"meatgrinder/internal/domain"
+	"sort"
+	"sync"
+	"time"
 )
 
+const commandQueueSize = 4096
+
+var ErrCommandQueueFull = &CommandError{Code: CodeBusy, Message: "command queue is full"}
+
+// ReplyFunc receives the outcome of a queued command on the game loop
+// goroutine. It must not block.
+type ReplyFunc func(error)
+
+type queuedCommand struct {
+	dto   command.DTO
+	reply ReplyFunc
+}
+
 type GameService struct {
 	world             *domain.World
 	snap              *WorldSnapshotService
 	logger            Logger
+	commands          chan queuedCommand
+	removals          removalList
+	events            *eventBuffer
+	latencies         latencyTable
+	alwaysRelevant    map[string]bool
+	tick              uint64
+	inputSeqs         map[string]uint64
+	moveSeqs          map[string]uint64
 	attackHandler     Handler
 	moveHandler       Handler
 	spawnHandler      Handler
@@ -17,17 +41,42 @@ type GameService struct {
 }
 
 func NewGameService(w *domain.World, logger Logger, s *WorldSnapshotService) *GameService {
+	events := &eventBuffer{}
 	return &GameService{
 		world:             w,
 		logger:            logger,
 		snap:              s,
+		commands:          make(chan queuedCommand, commandQueueSize),
+		events:            events,
+		alwaysRelevant:    make(map[string]bool),
+		inputSeqs:         make(map[string]uint64),
+		moveSeqs:          make(map[string]uint64),
 		attackHandler:     NewAttackHandler(w, logger),
 		moveHandler:       NewMoveHandler(w, logger),
-		spawnHandler:      NewSpawnHandler(w, logger),
-		disconnectHandler: NewDisconnectHandler(w, logger),
+		spawnHandler:      NewSpawnHandler(w, logger, events),
+		disconnectHandler: NewDisconnectHandler(w, logger, events),
+	}
+}
+
+// Enqueue is safe to call from any goroutine. The command is applied on the
+// game loop goroutine during the next Tick, after which reply, if not nil,
+// is called with the result.
+func (gs *GameService) Enqueue(d command.DTO, reply ReplyFunc) error {
+	select {
+	case gs.commands <- queuedCommand{dto: d, reply: reply}:
+		return nil
+	default:
+		return ErrCommandQueueFull
 	}
 }
 
+// Disconnect removes the player's character during the next Tick. Unlike
+// Enqueue it never fails: removals do not share the bounded command queue,
+// so a full queue cannot leave a departed player in the world.
+func (gs *GameService) Disconnect(id string) {
+	gs.removals.add(id)
+}
+
 func (gs *GameService) ProcessCommandDTO(d command.DTO) error {
 	cmd, err := command.MapDTOToCommand(d)
 	if err != nil {
@@ -42,18 +91,109 @@ func (gs *GameService) ProcessCommand(c command.Command) error {
 		return gs.spawnHandler.Handle(c)
 	case command.MOVE:
 		return gs.moveHandler.Handle(c)
-	case command.ATTACK:
+	case command.ATTACK, command.CAST:
 		return gs.attackHandler.Handle(c)
 	case command.DISCONNECT:
 		return gs.disconnectHandler.Handle(c)
 
 	default:
-		return fmt.Errorf("unknown cmd %v", c.Type)
+		return commandErrorf(CodeUnknownCommand, "unknown cmd %v", c.Type)
 	}
 }
 
-func (gs *GameService) UpdateWorld() {
-	gs.world.Update()
+// Tick advances the game by dt seconds. It must only be called from the
+// game loop goroutine.
+func (gs *GameService) Tick(dt float64) {
+	gs.tick++
+	gs.drainCommands()
+	gs.UpdateWorld(dt)
+	gs.BroadcastState()
+}
+
+func (gs *GameService) drainCommands() {
+	// Only drain what was queued when the tick started so a flood of
+	// commands cannot starve the simulation.
+	for n := len(gs.commands); n > 0; n-- {
+		qc := <-gs.commands
+		gs.apply(qc.dto, qc.reply)
+	}
+	for _, id := range gs.removals.take() {
+		gs.apply(command.DTO{Type: command.DISCONNECT, CharacterID: id}, nil)
+	}
+}
+
+func (gs *GameService) apply(d command.DTO, reply ReplyFunc) {
+	var err error
+	if !gs.staleMove(d) {
+		err = gs.ProcessCommandDTO(d)
+	}
+	gs.recordInput(d)
+	if reply != nil {
+		reply(err)
+	}
+}
+
+// removalList holds the players to remove on the next tick. It is written
+// by connection goroutines and emptied by the game loop.
+type removalList struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (l *removalList) add(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ids = append(l.ids, id)
+}
+
+func (l *removalList) take() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ids := l.ids
+	l.ids = nil
+	return ids
+}
+
+// staleMove reports whether d is a MOVE older than one already applied for
+// the player. Over UDP direction changes are sent reliably and their repeats
+// unreliably, so a late repeat must not undo a newer direction.
+func (gs *GameService) staleMove(d command.DTO) bool {
+	if d.Type != command.MOVE || d.Seq == 0 || d.CharacterID == "" {
+		return false
+	}
+	if d.Seq < gs.moveSeqs[d.CharacterID] {
+		return true
+	}
+	gs.moveSeqs[d.CharacterID] = d.Seq
+	return false
+}
+
+// recordInput remembers the highest Seq processed for each player, whether
+// or not the command succeeded. Commands can arrive out of order when they
+// travel on different lanes, so an older one never moves it back.
+func (gs *GameService) recordInput(d command.DTO) {
+	switch {
+	case d.Type == command.DISCONNECT:
+		delete(gs.inputSeqs, d.CharacterID)
+		delete(gs.moveSeqs, d.CharacterID)
+	case d.Seq != 0 && d.CharacterID != "" && d.Seq > gs.inputSeqs[d.CharacterID]:
+		gs.inputSeqs[d.CharacterID] = d.Seq
+	}
+}
+
+// DrainEvents returns the events produced since the last call. Like Tick it
+// must only be called from the game loop goroutine.
+func (gs *GameService) DrainEvents() []GameEvent {
+	return gs.events.drain()
+}
+
+func (gs *GameService) UpdateWorld(dt float64) {
+	for _, h := range gs.world.Update(dt) {
+		gs.events.Emit(GameEvent{Type: EventAttacked, Actor: h.Caster, Target: h.Target, Amount: h.Damage, Ability: h.Ability})
+		if h.Killed {
+			gs.events.Emit(GameEvent{Type: EventDied, Actor: h.Caster, Target: h.Target})
+		}
+	}
 }
 
 func (gs *GameService) BroadcastState() {
@@ -61,10 +201,65 @@ func (gs *GameService) BroadcastState() {
 		if c.IsDead() && c.State() == domain.StateDying {
 			id := c.ID()
 			gs.world.SpawnRandomCharacter(id)
+			gs.events.Emit(GameEvent{Type: EventSpawned, Actor: id})
 		}
 	}
 }
 
 func (gs *GameService) BuildWorldSnapshot() WorldSnapshot {
-	return gs.snap.BuildSnapshot(gs.world)
+	ws := gs.snap.BuildSnapshot(gs.world)
+	ws.Tick = gs.tick
+	ws.ServerTime = time.Now().UnixNano()
+	for i := range ws.Characters {
+		c := &ws.Characters[i]
+		if l, ok := gs.latencies.get(c.ID); ok {
+			c.Ping = int(l.RTT / time.Millisecond)
+		}
+		c.AlwaysRelevant = gs.alwaysRelevant[c.ID]
+		c.InputSeq = gs.inputSeqs[c.ID]
+	}
+	return ws
+}
+
+// SetAlwaysRelevant lets a game mode exempt a character, say a flag carrier
+// or a boss, from area-of-interest filtering. Like Tick it must only be
+// called from the game loop goroutine.
+func (gs *GameService) SetAlwaysRelevant(id string, relevant bool) {
+	if relevant {
+		gs.alwaysRelevant[id] = true
+	} else {
+		delete(gs.alwaysRelevant, id)
+	}
+}
+
+// SetLatency records the latest measurement for a player. It is safe to
+// call from any goroutine.
+func (gs *GameService) SetLatency(id string, l Latency) {
+	gs.latencies.set(id, l)
+}
+
+func (gs *GameService) Latency(id string) (Latency, bool) {
+	return gs.latencies.get(id)
+}
+
+// ClearLatency forgets a player's measurement once its connection is gone
+// for good.
+func (gs *GameService) ClearLatency(id string) {
+	gs.latencies.remove(id)
+}
+
+// Shutdown writes the final state of the world to the event log. Call it
+// once the game loop has stopped.
+func (gs *GameService) Shutdown() {
+	ids := make([]string, 0, len(gs.world.Characters))
+	for id := range gs.world.Characters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		c := gs.world.Characters[id]
+		x, y := c.Position()
+		gs.logger.LogEvent(fmt.Sprintf("final state: %s %s health %.1f at (%.0f, %.0f)", id, c.State(), c.Health(), x, y))
+	}
+	gs.logger.LogEvent(fmt.Sprintf("server stopped with %d characters", len(ids)))
 }
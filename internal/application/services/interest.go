@@ -0,0 +1,70 @@
+package services
+
+// Interest selects the part of the world a viewer is sent: characters and
+// projectiles within Radius of the viewer's own character plus characters
+// the game marked always relevant. A zero Radius, or a viewer without a
+// character such as a spectator, sees everything.
+type Interest struct {
+	Radius float64
+}
+
+func (in Interest) View(ws WorldSnapshot, viewer string) WorldSnapshot {
+	if in.Radius <= 0 {
+		return ws
+	}
+	var self *CharacterSnapshot
+	for i := range ws.Characters {
+		if ws.Characters[i].ID == viewer {
+			self = &ws.Characters[i]
+			break
+		}
+	}
+	if self == nil {
+		return ws
+	}
+
+	r2 := in.Radius * in.Radius
+	view := ws
+	view.Characters = make([]CharacterSnapshot, 0, len(ws.Characters))
+	for _, c := range ws.Characters {
+		dx, dy := c.X-self.X, c.Y-self.Y
+		if c.ID == viewer || c.AlwaysRelevant || dx*dx+dy*dy <= r2 {
+			view.Characters = append(view.Characters, c)
+		}
+	}
+	view.Projectiles = nil
+	for _, p := range ws.Projectiles {
+		dx, dy := p.X-self.X, p.Y-self.Y
+		if dx*dx+dy*dy <= r2 {
+			view.Projectiles = append(view.Projectiles, p)
+		}
+	}
+	return view
+}
+
+// DiffViews is DiffSnapshots for filtered views of world. Characters that
+// dropped out of the view but are still in the world are reported in
+// Despawned instead of Removed.
+func DiffViews(base, cur, world WorldSnapshot) SnapshotDelta {
+	d := DiffSnapshots(base, cur)
+	if len(d.Removed) == 0 {
+		return d
+	}
+	alive := make(map[string]struct{}, len(world.Characters))
+	for _, c := range world.Characters {
+		alive[c.ID] = struct{}{}
+	}
+	removed := d.Removed[:0]
+	for _, id := range d.Removed {
+		if _, ok := alive[id]; ok {
+			d.Despawned = append(d.Despawned, id)
+		} else {
+			removed = append(removed, id)
+		}
+	}
+	d.Removed = removed
+	if len(d.Removed) == 0 {
+		d.Removed = nil
+	}
+	return d
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// Latency is a player's network timing as measured by the transport.
+// ClockOffset is the client's clock minus the server's.
+type Latency struct {
+	RTT         time.Duration
+	ClockOffset time.Duration
+}
+
+// latencyTable is written by connection goroutines and read by the game
+// loop when it builds snapshots.
+type latencyTable struct {
+	mu sync.RWMutex
+	m  map[string]Latency
+}
+
+func (t *latencyTable) set(id string, l Latency) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.m == nil {
+		t.m = make(map[string]Latency)
+	}
+	t.m[id] = l
+}
+
+func (t *latencyTable) get(id string) (Latency, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	l, ok := t.m[id]
+	return l, ok
+}
+
+func (t *latencyTable) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.m, id)
+}
@@ -0,0 +1,178 @@
+package services
+
+import "slices"
+
+// SnapshotDelta describes how to turn a baseline WorldSnapshot into a newer
+// one. Only fields that differ from the baseline are set in Changed; the
+// header fields and the short-lived projectiles are always those of the
+// newer snapshot.
+type SnapshotDelta struct {
+	Tick         uint64         `json:"tick"`
+	ServerTime   int64          `json:"server_time"`
+	LastInputSeq uint64         `json:"last_input_seq,omitempty"`
+	Abilities    []AbilityState `json:"abilities,omitempty"`
+	Energy       float64        `json:"energy,omitempty"`
+
+	Projectiles []ProjectileSnapshot `json:"projectiles,omitempty"`
+
+	Added   []CharacterSnapshot `json:"added,omitempty"`
+	Removed []string            `json:"removed,omitempty"`
+	Changed []CharacterDelta    `json:"changed,omitempty"`
+	// Despawned lists characters that left the recipient's area of interest
+	// but are still in the world. They are dropped like Removed ones; the
+	// hint lets a client fade them out rather than treat them as gone.
+	Despawned []string `json:"despawned,omitempty"`
+}
+
+type CharacterDelta struct {
+	ID     string   `json:"id"`
+	Class  *string  `json:"class,omitempty"`
+	State  *string  `json:"state,omitempty"`
+	Health *float64 `json:"health,omitempty"`
+	X      *float64 `json:"x,omitempty"`
+	Y      *float64 `json:"y,omitempty"`
+	Flash  *bool    `json:"flash,omitempty"`
+	Facing *float64 `json:"facing,omitempty"`
+	Ping   *int     `json:"ping,omitempty"`
+	// Effects replaces the whole list when set; an empty list clears it.
+	Effects *[]EffectSnapshot `json:"effects,omitempty"`
+}
+
+func DiffSnapshots(base, cur WorldSnapshot) SnapshotDelta {
+	d := SnapshotDelta{
+		Tick:         cur.Tick,
+		ServerTime:   cur.ServerTime,
+		LastInputSeq: cur.LastInputSeq,
+		Abilities:    cur.Abilities,
+		Energy:       cur.Energy,
+		Projectiles:  cur.Projectiles,
+	}
+	prev := make(map[string]CharacterSnapshot, len(base.Characters))
+	for _, c := range base.Characters {
+		prev[c.ID] = c
+	}
+	for _, c := range cur.Characters {
+		p, ok := prev[c.ID]
+		if !ok {
+			d.Added = append(d.Added, c)
+			continue
+		}
+		delete(prev, c.ID)
+		if cd, changed := diffCharacter(p, c); changed {
+			d.Changed = append(d.Changed, cd)
+		}
+	}
+	for _, c := range base.Characters {
+		if _, gone := prev[c.ID]; gone {
+			d.Removed = append(d.Removed, c.ID)
+		}
+	}
+	return d
+}
+
+func diffCharacter(p, c CharacterSnapshot) (CharacterDelta, bool) {
+	d := CharacterDelta{ID: c.ID}
+	changed := false
+	if p.Class != c.Class {
+		d.Class, changed = &c.Class, true
+	}
+	if p.State != c.State {
+		d.State, changed = &c.State, true
+	}
+	if p.Health != c.Health {
+		d.Health, changed = &c.Health, true
+	}
+	if p.X != c.X {
+		d.X, changed = &c.X, true
+	}
+	if p.Y != c.Y {
+		d.Y, changed = &c.Y, true
+	}
+	if p.Flash != c.Flash {
+		d.Flash, changed = &c.Flash, true
+	}
+	if p.Facing != c.Facing {
+		d.Facing, changed = &c.Facing, true
+	}
+	if p.Ping != c.Ping {
+		d.Ping, changed = &c.Ping, true
+	}
+	if !slices.Equal(p.Effects, c.Effects) {
+		effects := c.Effects
+		if effects == nil {
+			effects = []EffectSnapshot{}
+		}
+		d.Effects, changed = &effects, true
+	}
+	return d, changed
+}
+
+// ApplyDelta returns a new snapshot; base is left untouched.
+func ApplyDelta(base WorldSnapshot, d SnapshotDelta) WorldSnapshot {
+	removed := make(map[string]struct{}, len(d.Removed)+len(d.Despawned))
+	for _, id := range d.Removed {
+		removed[id] = struct{}{}
+	}
+	for _, id := range d.Despawned {
+		removed[id] = struct{}{}
+	}
+	changes := make(map[string]CharacterDelta, len(d.Changed))
+	for _, cd := range d.Changed {
+		changes[cd.ID] = cd
+	}
+
+	out := WorldSnapshot{
+		Tick:         d.Tick,
+		ServerTime:   d.ServerTime,
+		LastInputSeq: d.LastInputSeq,
+		Abilities:    d.Abilities,
+		Energy:       d.Energy,
+		Projectiles:  d.Projectiles,
+		Characters:   make([]CharacterSnapshot, 0, len(base.Characters)+len(d.Added)),
+	}
+	for _, c := range base.Characters {
+		if _, ok := removed[c.ID]; ok {
+			continue
+		}
+		if cd, ok := changes[c.ID]; ok {
+			c = applyCharacterDelta(c, cd)
+		}
+		out.Characters = append(out.Characters, c)
+	}
+	out.Characters = append(out.Characters, d.Added...)
+	return out
+}
+
+func applyCharacterDelta(c CharacterSnapshot, d CharacterDelta) CharacterSnapshot {
+	if d.Class != nil {
+		c.Class = *d.Class
+	}
+	if d.State != nil {
+		c.State = *d.State
+	}
+	if d.Health != nil {
+		c.Health = *d.Health
+	}
+	if d.X != nil {
+		c.X = *d.X
+	}
+	if d.Y != nil {
+		c.Y = *d.Y
+	}
+	if d.Flash != nil {
+		c.Flash = *d.Flash
+	}
+	if d.Facing != nil {
+		c.Facing = *d.Facing
+	}
+	if d.Ping != nil {
+		c.Ping = *d.Ping
+	}
+	if d.Effects != nil {
+		c.Effects = nil
+		if len(*d.Effects) > 0 {
+			c.Effects = *d.Effects
+		}
+	}
+	return c
+}
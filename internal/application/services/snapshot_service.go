@@ -1,6 +1,7 @@
 package services
 
 import (
+	"math"
 	"meatgrinder/internal/domain"
 )
 
@@ -11,7 +12,38 @@ func NewWorldSnapshotService() *WorldSnapshotService {
 }
 
 type WorldSnapshot struct {
-	Characters []CharacterSnapshot `json:"characters"`
+	// Tick is the number of simulation steps run before the snapshot was
+	// taken and ServerTime the server clock at that moment, in Unix
+	// nanoseconds.
+	Tick       uint64 `json:"tick"`
+	ServerTime int64  `json:"server_time"`
+	// LastInputSeq is the Seq of the recipient's last command processed
+	// before the snapshot was taken.
+	LastInputSeq uint64 `json:"last_input_seq,omitempty"`
+	// Abilities and Energy are the recipient's own.
+	Abilities   []AbilityState       `json:"abilities,omitempty"`
+	Energy      float64              `json:"energy,omitempty"`
+	Characters  []CharacterSnapshot  `json:"characters"`
+	Projectiles []ProjectileSnapshot `json:"projectiles,omitempty"`
+}
+
+// ProjectileSnapshot is a projectile in flight. Kind names the ability it
+// carries; velocities are in units per second.
+type ProjectileSnapshot struct {
+	ID    uint64  `json:"id"`
+	Kind  string  `json:"kind"`
+	Owner string  `json:"owner"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	VX    float64 `json:"vx"`
+	VY    float64 `json:"vy"`
+}
+
+// AbilityState is one of a character's abilities and the seconds left
+// until it can be cast again.
+type AbilityState struct {
+	Name     string  `json:"name"`
+	Cooldown float64 `json:"cooldown,omitempty"`
 }
 
 type CharacterSnapshot struct {
@@ -22,26 +54,87 @@ type CharacterSnapshot struct {
 	X      float64 `json:"x"`
 	Y      float64 `json:"y"`
 	Flash  bool    `json:"flash"`
+	// Facing is the angle the character faces in radians: 0 along +X,
+	// π/2 along +Y.
+	Facing float64 `json:"facing"`
+	// Ping is the player's round-trip time in milliseconds, zero for NPCs.
+	Ping    int              `json:"ping,omitempty"`
+	Effects []EffectSnapshot `json:"effects,omitempty"`
+	// AlwaysRelevant characters are sent to every viewer regardless of
+	// distance. It only matters on the server and is not transmitted.
+	AlwaysRelevant bool `json:"-"`
+	// InputSeq is the Seq of the last command processed for the character.
+	// The server copies it into its owner's LastInputSeq, and Abilities and
+	// Energy into the owner's snapshot header.
+	InputSeq  uint64         `json:"-"`
+	Abilities []AbilityState `json:"-"`
+	Energy    float64        `json:"-"`
+}
+
+// EffectSnapshot is one active status effect; see domain.Effect.
+type EffectSnapshot struct {
+	Kind      string  `json:"kind"`
+	Magnitude float64 `json:"magnitude,omitempty"`
+	Remaining float64 `json:"remaining"`
 }
 
 func (svc *WorldSnapshotService) BuildSnapshot(w *domain.World) WorldSnapshot {
 	var snap WorldSnapshot
 	for _, ch := range w.Characters {
 		xx, yy := ch.Position()
+		fx, fy := ch.Facing()
 		cc := "warrior"
 		switch ch.(type) {
 		case *domain.Mage:
 			cc = "mage"
 		}
 		snap.Characters = append(snap.Characters, CharacterSnapshot{
-			ID:     ch.ID(),
-			Class:  cc,
-			State:  string(ch.State()),
-			Health: ch.Health(),
-			X:      xx,
-			Y:      yy,
-			Flash:  ch.FlashRed(),
+			ID:        ch.ID(),
+			Class:     cc,
+			State:     string(ch.State()),
+			Health:    ch.Health(),
+			X:         xx,
+			Y:         yy,
+			Flash:     ch.FlashRed(),
+			Facing:    math.Atan2(fy, fx),
+			Effects:   effectSnapshots(ch.Effects()),
+			Abilities: abilityStates(ch),
+			Energy:    ch.Energy(),
+		})
+	}
+	for _, p := range w.Projectiles {
+		snap.Projectiles = append(snap.Projectiles, ProjectileSnapshot{
+			ID:    p.ID,
+			Kind:  p.Ability.Name,
+			Owner: p.Owner,
+			X:     p.X,
+			Y:     p.Y,
+			VX:    p.VX,
+			VY:    p.VY,
 		})
 	}
 	return snap
 }
+
+func effectSnapshots(es []domain.Effect) []EffectSnapshot {
+	if len(es) == 0 {
+		return nil
+	}
+	out := make([]EffectSnapshot, len(es))
+	for i, e := range es {
+		out[i] = EffectSnapshot{Kind: string(e.Kind), Magnitude: e.Magnitude, Remaining: e.Remaining}
+	}
+	return out
+}
+
+func abilityStates(ch domain.Character) []AbilityState {
+	abilities := ch.Abilities()
+	if len(abilities) == 0 {
+		return nil
+	}
+	out := make([]AbilityState, len(abilities))
+	for i, a := range abilities {
+		out[i] = AbilityState{Name: a.Name, Cooldown: ch.Cooldown(a.Name)}
+	}
+	return out
+}
@@ -8,12 +8,14 @@ import (
 type SpawnHandler struct {
 	logger Logger
 	world  *domain.World
+	events EventSink
 }
 
-func NewSpawnHandler(world *domain.World, logger Logger) *SpawnHandler {
+func NewSpawnHandler(world *domain.World, logger Logger, events EventSink) *SpawnHandler {
 	return &SpawnHandler{
 		world:  world,
 		logger: logger,
+		events: events,
 	}
 }
 
@@ -23,5 +25,6 @@ func (h *SpawnHandler) Handle(c command.Command) error {
 	}
 
 	h.world.SpawnRandomCharacter(c.CharacterID)
+	h.events.Emit(GameEvent{Type: EventSpawned, Actor: c.CharacterID})
 	return nil
 }
@@ -2,17 +2,19 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"image"
 	_ "image/png"
 	"log"
 	"math"
-	"math/rand"
 	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/interpolation"
+	"meatgrinder/internal/application/prediction"
+	"meatgrinder/internal/application/services"
 	"meatgrinder/internal/cmd/settings"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -23,86 +25,122 @@ import (
 	"meatgrinder/internal/infrastructure/network"
 )
 
-type WorldSnapshot struct {
-	Characters []CharacterSnapshot `json:"characters"`
-}
-
-type CharacterSnapshot struct {
-	ID     string  `json:"id"`
-	Class  string  `json:"class"`
-	State  string  `json:"state"`
-	Health float64 `json:"health"`
-	X      float64 `json:"x"`
-	Y      float64 `json:"y"`
-	Flash  bool    `json:"flash"`
-}
-
-type Fireball struct {
-	x, y             float64
-	targetX, targetY float64
-	img              *ebiten.Image
-	timer            float64
-}
+const (
+	feedSize = 5
+	// frameTime is the length of an ebiten tick at its default 60 TPS.
+	frameTime = 1.0 / 60
+)
 
 type Game struct {
-	ctx                     context.Context
-	cancel                  context.CancelFunc
-	client                  *network.Client
-	id                      string
-	w, h                    int
-	mu                      sync.Mutex
-	snap                    WorldSnapshot
-	prevSnap                WorldSnapshot
-	fireballs               []Fireball
+	ctx         context.Context
+	cancel      context.CancelFunc
+	client      *network.Client
+	id          string
+	w, h        int
+	mu          sync.Mutex
+	interp      *interpolation.Buffer
+	view        []services.CharacterSnapshot
+	projectiles []services.ProjectileSnapshot
+	abilities   []services.AbilityState
+	energy      float64
+	pred        *prediction.Predictor
+	feed        []string
+	// requests names the ability of each request awaiting its result.
+	requests                map[uint64]string
 	bg                      *ebiten.Image
 	mIdle, mRun, mAtk, mDie *ebiten.Image
 	wIdle, wRun, wAtk, wDie *ebiten.Image
 	fireballImg             *ebiten.Image
 	spW, spH                float64
-	speed                   float64
+	dirX, dirY              float64
 }
 
-func NewGame(addr, id string) (*Game, error) {
+func NewGame(cfg network.ClientConfig, interp *interpolation.Buffer) (*Game, error) {
 	ctx, c := context.WithCancel(context.Background())
 	g := &Game{
-		ctx:       ctx,
-		cancel:    c,
-		id:        id,
-		w:         settings.MapWidth,
-		h:         settings.MapHeight,
-		speed:     2,
-		fireballs: []Fireball{},
-	}
-	cl := network.NewClient(addr)
+		ctx:      ctx,
+		cancel:   c,
+		w:        settings.MapWidth,
+		h:        settings.MapHeight,
+		interp:   interp,
+		requests: make(map[uint64]string),
+	}
+	cl := network.NewClient(cfg, network.ClientHandlers{
+		Snapshot: g.onSnapshot,
+		Event:    g.onEvent,
+		Result:   g.onResult,
+		Chat: func(m network.ChatMessage) {
+			g.addToFeed(fmt.Sprintf("%s: %s", m.From, m.Text))
+		},
+		Notice: func(n network.Notice) {
+			g.addToFeed(fmt.Sprintf("[%s] %s", n.Level, n.Text))
+		},
+		Reconnect: g.onReconnect,
+		Queued: func(pos int) {
+			log.Printf("server is full, waiting to join at position %d", pos)
+		},
+	})
 	if err := cl.Connect(ctx); err != nil {
 		return nil, err
 	}
+	g.mu.Lock()
 	g.client = cl
-	go g.listen()
+	g.id = cl.CharacterID()
+	g.pred = prediction.NewPredictor(g.id, float64(g.w), float64(g.h))
+	g.mu.Unlock()
+	g.spawn()
+
+	return g, nil
+}
 
+func (g *Game) spawn() {
 	spawnCmd := command.DTO{
 		Type:        command.SPAWN,
-		CharacterID: id,
+		CharacterID: g.id,
 		Data:        map[string]interface{}{},
 	}
 	_ = g.client.SendCommand(spawnCmd)
+}
 
-	return g, nil
+func (g *Game) onReconnect(resumed bool) {
+	g.mu.Lock()
+	clear(g.requests)
+	g.mu.Unlock()
+	if resumed {
+		g.addToFeed("reconnected")
+		return
+	}
+	g.addToFeed("reconnected, respawning")
+	g.spawn()
 }
 
-func (g *Game) listen() {
-	for data := range g.client.UpdatesChannel() {
-		b, err := json.Marshal(data)
-		if err != nil {
-			continue
-		}
-		var ws WorldSnapshot
-		if err := json.Unmarshal(b, &ws); err != nil {
-			continue
-		}
-		g.mu.Lock()
-		g.snap = ws
-		g.mu.Unlock()
+func (g *Game) onSnapshot(ws services.WorldSnapshot) {
+	g.mu.Lock()
+	g.interp.Push(ws, time.Now())
+	g.abilities, g.energy = ws.Abilities, ws.Energy
+	if g.pred != nil {
+		g.pred.Reconcile(ws)
+	}
+	g.mu.Unlock()
+}
+
+func (g *Game) onEvent(e services.GameEvent) {
+	switch e.Type {
+	case services.EventDied:
+		g.addToFeed(fmt.Sprintf("%s killed %s", e.Actor, e.Target))
+	case services.EventSpawned:
+		g.addToFeed(fmt.Sprintf("%s spawned", e.Actor))
+	case services.EventDisconnected:
+		g.addToFeed(fmt.Sprintf("%s left", e.Actor))
+	}
+}
+
+func (g *Game) addToFeed(line string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.feed = append(g.feed, line)
+	if len(g.feed) > feedSize {
+		g.feed = g.feed[len(g.feed)-feedSize:]
 	}
 }
 
@@ -111,70 +149,141 @@ func (g *Game) Layout(int, int) (int, int) {
 }
 
 func (g *Game) Update() error {
-	var target *CharacterSnapshot
-	var tid string
-
+	var dx, dy float64
 	if ebiten.IsKeyPressed(ebiten.KeyW) {
-		g.sendMoveCommand(0, -g.speed)
+		dy--
 	}
 	if ebiten.IsKeyPressed(ebiten.KeyS) {
-		g.sendMoveCommand(0, g.speed)
+		dy++
 	}
 	if ebiten.IsKeyPressed(ebiten.KeyA) {
-		g.sendMoveCommand(-g.speed, 0)
+		dx--
 	}
 	if ebiten.IsKeyPressed(ebiten.KeyD) {
-		g.sendMoveCommand(g.speed, 0)
+		dx++
+	}
+	// A change of direction, stopping included, is sent reliably. While
+	// moving the direction is also resent every frame, unreliably over UDP,
+	// because the server stops a character that has not been given one for
+	// a while; a lost repeat only costs a frame.
+	switch {
+	case dx != g.dirX || dy != g.dirY:
+		g.sendMoveCommand(dx, dy, true)
+	case dx != 0 || dy != 0:
+		g.sendMoveCommand(dx, dy, false)
 	}
+	g.dirX, g.dirY = dx, dy
 
 	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
 		mx, my := ebiten.CursorPosition()
-		tid = g.findCharUnder(float64(mx), float64(my))
+		tid := g.findCharUnder(float64(mx), float64(my))
 		if tid != "" && tid != g.id {
-			_ = g.client.SendCommand(command.DTO{
+			g.mu.Lock()
+			name := "attack"
+			if len(g.abilities) > 0 {
+				name = g.abilities[0].Name
+			}
+			g.mu.Unlock()
+			g.request(name, command.DTO{
 				Type:        command.ATTACK,
 				CharacterID: g.id,
 				Data:        map[string]interface{}{"target_id": tid},
 			})
-
-			g.mu.Lock()
-			for _, c := range g.snap.Characters {
-				if c.ID == tid {
-					target = &c
-					break
-				}
-			}
-			var attacker *CharacterSnapshot
-			for _, c := range g.snap.Characters {
-				if c.ID == g.id {
-					attacker = &c
-					break
-				}
-			}
-			g.mu.Unlock()
-
-			if target != nil && attacker != nil && strings.ToLower(attacker.Class) == "mage" {
-				fb := Fireball{
-					x:       attacker.X,
-					y:       attacker.Y,
-					targetX: target.X,
-					targetY: target.Y,
-					img:     g.fireballImg,
-					timer:   1.0,
-				}
-				g.mu.Lock()
-				g.fireballs = append(g.fireballs, fb)
-				g.mu.Unlock()
-			}
 		}
 	}
 
-	g.updateFireballs(1.0 / 60.0)
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight) {
+		g.castSecondary()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyQ) {
+		g.castAtCursor()
+	}
+
+	now := time.Now()
+	g.mu.Lock()
+	g.pred.Advance(frameTime)
+	g.view = g.interp.Sample(now)
+	g.projectiles = g.interp.Projectiles(now)
+	g.mu.Unlock()
 	return nil
 }
 
-func (g *Game) sendMoveCommand(dx, dy float64) {
-	_ = g.client.SendCommand(command.DTO{
+// castSecondary casts the class's second ability at the character under the
+// cursor.
+func (g *Game) castSecondary() {
+	mx, my := ebiten.CursorPosition()
+	g.mu.Lock()
+	tid := g.findCharUnder(float64(mx), float64(my))
+	var name string
+	if len(g.abilities) > 1 {
+		name = g.abilities[1].Name
+	}
+	g.mu.Unlock()
+	if name == "" || tid == "" || tid == g.id {
+		return
+	}
+	g.request(name, command.DTO{
+		Type:        command.CAST,
+		CharacterID: g.id,
+		Data:        map[string]interface{}{"ability": name, "target_id": tid},
+	})
+}
+
+// castAtCursor casts the class's third ability, a cone or an area, at the
+// point under the cursor.
+func (g *Game) castAtCursor() {
+	mx, my := ebiten.CursorPosition()
+	g.mu.Lock()
+	var name string
+	if len(g.abilities) > 2 {
+		name = g.abilities[2].Name
+	}
+	g.mu.Unlock()
+	if name == "" {
+		return
+	}
+	g.request(name, command.DTO{
+		Type:        command.CAST,
+		CharacterID: g.id,
+		Data:        map[string]interface{}{"ability": name, "x": float64(mx), "y": float64(my)},
+	})
+}
+
+// request sends d and remembers which ability it uses, so a failure can name
+// it. Like sendMoveCommand it holds g.mu while sending, so the result cannot
+// be handled before the request is recorded.
+func (g *Game) request(ability string, d command.DTO) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if id, err := g.client.Request(d); err == nil {
+		g.requests[id] = ability
+	}
+}
+
+func (g *Game) onResult(r network.CommandResult) {
+	g.mu.Lock()
+	ability, ok := g.requests[r.RequestID]
+	delete(g.requests, r.RequestID)
+	g.mu.Unlock()
+	if r.OK() {
+		return
+	}
+	if !ok {
+		ability = "request"
+	}
+	g.addToFeed(fmt.Sprintf("%s failed: %s", ability, r.Message))
+}
+
+// sendMoveCommand holds g.mu while sending so a snapshot acknowledging the
+// input cannot be reconciled before the input is recorded.
+func (g *Game) sendMoveCommand(dx, dy float64, reliable bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	send := g.client.SendInput
+	if reliable {
+		send = g.client.SendReliableInput
+	}
+	seq, err := send(command.DTO{
 		Type:        command.MOVE,
 		CharacterID: g.id,
 		Data: map[string]interface{}{
@@ -182,31 +291,9 @@ func (g *Game) sendMoveCommand(dx, dy float64) {
 			"dy": dy,
 		},
 	})
-}
-
-func (g *Game) updateFireballs(dt float64) {
-	g.mu.Lock()
-	defer g.mu.Unlock()
-	newFireballs := g.fireballs[:0]
-	for i := range g.fireballs {
-		fb := &g.fireballs[i]
-		fb.timer -= dt
-		if fb.timer > 0 {
-			dx := fb.targetX - fb.x
-			dy := fb.targetY - fb.y
-			dist := math.Hypot(dx, dy)
-			if dist > 0 {
-				speed := 1000.0
-				fb.x += (dx / dist) * speed * dt
-				fb.y += (dy / dist) * speed * dt
-			}
-			if fb.x < 0 || fb.x > float64(g.w) || fb.y < 0 || fb.y > float64(g.h) {
-				continue
-			}
-			newFireballs = append(newFireballs, g.fireballs[i])
-		}
+	if err == nil {
+		g.pred.Apply(prediction.Input{Seq: seq, DX: dx, DY: dy})
 	}
-	g.fireballs = newFireballs
 }
 
 func (g *Game) Draw(screen *ebiten.Image) {
@@ -218,16 +305,19 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	for _, fb := range g.fireballs {
+	for _, p := range g.projectiles {
+		if g.fireballImg == nil {
+			break
+		}
 		op := &ebiten.DrawImageOptions{}
 		scale := 0.1
 		op.GeoM.Scale(scale, scale)
-		fbWidth, fbHeight := fb.img.Size()
-		op.GeoM.Translate(fb.x-float64(fbWidth)*scale/2, fb.y-float64(fbHeight)*scale/2)
-		screen.DrawImage(fb.img, op)
+		fbWidth, fbHeight := g.fireballImg.Size()
+		op.GeoM.Translate(p.X-float64(fbWidth)*scale/2, p.Y-float64(fbHeight)*scale/2)
+		screen.DrawImage(g.fireballImg, op)
 	}
 
-	for _, c := range g.snap.Characters {
+	for _, c := range g.view {
 		img := g.pickSprite(c.Class, c.State)
 		if strings.ToLower(c.State) == "dying" {
 			img = g.dyingSprite(c.Class)
@@ -237,11 +327,58 @@ func (g *Game) Draw(screen *ebiten.Image) {
 			op.ColorM.Scale(1, 0, 0, 1)
 		}
 		scale := 0.5
-		op.GeoM.Scale(scale, scale)
 		charWidth, charHeight := img.Size()
+		// Sprites face right; mirror those facing left.
+		if math.Cos(c.Facing) < 0 {
+			op.GeoM.Scale(-1, 1)
+			op.GeoM.Translate(float64(charWidth), 0)
+		}
+		op.GeoM.Scale(scale, scale)
+		if c.ID == g.id {
+			if x, y, ok := g.pred.Position(); ok {
+				c.X, c.Y = x, y
+			}
+		}
 		op.GeoM.Translate(c.X-float64(charWidth)*scale/2, c.Y-float64(charHeight)*scale/2)
 		screen.DrawImage(img, op)
+		if label := effectLabel(c.Effects); label != "" {
+			ebitenutil.DebugPrintAt(screen, label, int(c.X)-len(label)*3, int(c.Y+float64(charHeight)*scale/2))
+		}
 	}
+
+	for i, line := range g.feed {
+		ebitenutil.DebugPrintAt(screen, line, 8, 8+i*16)
+	}
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("ping %dms", g.client.Latency().RTT.Milliseconds()), g.w-80, 8)
+	ebitenutil.DebugPrintAt(screen, abilityBar(g.abilities, g.energy), 8, g.h-24)
+}
+
+// abilityBar shows the player's energy and each ability's cooldown, e.g.
+// "energy 70  slash ready  shield_bash 3.2s".
+func abilityBar(as []services.AbilityState, energy float64) string {
+	if len(as) == 0 {
+		return ""
+	}
+	parts := []string{fmt.Sprintf("energy %.0f", energy)}
+	for _, a := range as {
+		if a.Cooldown > 0 {
+			parts = append(parts, fmt.Sprintf("%s %.1fs", a.Name, a.Cooldown))
+		} else {
+			parts = append(parts, a.Name+" ready")
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+// effectLabel names each kind of effect once, e.g. "slow burn".
+func effectLabel(es []services.EffectSnapshot) string {
+	var kinds []string
+	for _, e := range es {
+		if !slices.Contains(kinds, e.Kind) {
+			kinds = append(kinds, e.Kind)
+		}
+	}
+	return strings.Join(kinds, " ")
 }
 
 func (g *Game) pickSprite(class, st string) *ebiten.Image {
@@ -277,7 +414,7 @@ func (g *Game) dyingSprite(class string) *ebiten.Image {
 }
 
 func (g *Game) findCharUnder(mx, my float64) string {
-	for _, c := range g.snap.Characters {
+	for _, c := range g.view {
 		sw := 0.5 * g.spW
 		sh := 0.5 * g.spH
 		if mx >= c.X-sw/2 && mx <= c.X+sw/2 && my >= c.Y-sh/2 && my <= c.Y+sh/2 {
@@ -340,17 +477,18 @@ func loadImg(path string) (*ebiten.Image, error) {
 }
 
 func main() {
-	addr := flag.String("addr", "localhost:8080", "server addr")
-	id := flag.String("id", "", "character ID (empty => random)")
+	addr := flag.String("addr", "localhost:8080", "server addr: host:port for TCP, tls://host:port, ws://host:port/ws, wss://host:port/ws or udp://host:port")
+	id := flag.String("id", "", "character ID (empty => assigned by server)")
+	pin := flag.String("tls-pin", "", "PEM certificate the TLS server must present, e.g. a self-signed one")
+	delay := flag.Duration("interp-delay", 300*time.Millisecond, "how far behind the server other players are rendered")
+	extrapolate := flag.Duration("max-extrapolation", 250*time.Millisecond, "how long other players keep moving when snapshots are late")
 	assetsDir := flag.String("assets", "assets", "path to assets folder")
 	flag.Parse()
 
-	if *id == "" {
-		rand.New(rand.NewSource(time.Now().UnixNano()))
-		*id = fmt.Sprintf("player-%04d", rand.Intn(9999))
-	}
-
-	g, err := NewGame(*addr, *id)
+	cfg := network.DefaultClientConfig(*addr)
+	cfg.CharacterID = *id
+	cfg.TLSPinnedCert = *pin
+	g, err := NewGame(cfg, interpolation.NewBuffer(*delay, *extrapolate))
 	if err != nil {
 		log.Fatal(err)
 	}
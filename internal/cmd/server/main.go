@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"meatgrinder/internal/application/services"
 	"meatgrinder/internal/cmd/settings"
@@ -11,10 +12,14 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 )
 
 func main() {
+	tlsCert := flag.String("tls-cert", "", "PEM certificate; with -tls-key, TCP and WebSocket clients must use TLS and UDP is off")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	interest := flag.Float64("interest-radius", 600, "only send players the characters within this distance of theirs; 0 sends the whole world")
+	flag.Parse()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		ch := make(chan os.Signal, 1)
@@ -26,23 +31,45 @@ func main() {
 	svc := services.NewWorldSnapshotService()
 	l := persistence.NewFileLogger("game_events.log")
 	gs := services.NewGameService(w, l, svc)
-	srv := network.NewServer(":8080", gs)
+	cfg := network.DefaultServerConfig(":8080")
+	cfg.WebSocketAddr = ":8081"
+	cfg.TLSCertFile = *tlsCert
+	cfg.TLSKeyFile = *tlsKey
+	// UDP cannot be encrypted, so it is only served without TLS.
+	if *tlsCert == "" && *tlsKey == "" {
+		cfg.UDPAddr = ":8082"
+	}
+	cfg.InterestRadius = *interest
+	cfg.MaxPlayers = 32
+	cfg.MaxConnsPerIP = 16
+	srv := network.NewServer(cfg, gs)
 
+	loop := services.NewGameLoop(gs, srv, settings.TickRate, settings.SnapshotRate)
+	loopDone := make(chan struct{})
 	go func() {
-		t := time.NewTicker(time.Second / 120)
-		defer t.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-t.C:
-				gs.UpdateWorld()
-				gs.BroadcastState()
-			}
-		}
+		loop.Run(ctx)
+		close(loopDone)
 	}()
 
+	go func() {
+		if err := srv.ListenAndServeWebSocket(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("websocket: %v", err)
+		}
+	}()
+	if cfg.UDPAddr != "" {
+		go func() {
+			if err := srv.ListenAndServeUDP(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("udp: %v", err)
+			}
+		}()
+	}
 	if err := srv.ListenAndServe(ctx); err != nil {
-		log.Fatal(err)
+		if ctx.Err() == nil {
+			log.Fatal(err)
+		}
+		log.Printf("shutdown: %v", err)
 	}
+	<-loopDone
+	gs.Shutdown()
+	log.Print("server stopped")
 }
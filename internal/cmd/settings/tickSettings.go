@@ -0,0 +1,6 @@
+package settings
+
+const (
+	TickRate     = 120
+	SnapshotRate = 5
+)
@@ -0,0 +1,295 @@
+package domain
+
+import (
+	"errors"
+	"math"
+)
+
+// Targeting says what an ability is aimed at.
+type Targeting int
+
+const (
+	// TargetEnemy abilities need another living character within Range.
+	TargetEnemy Targeting = iota
+	// TargetSelf abilities affect the caster.
+	TargetSelf
+	// TargetCone abilities hit every other living character within Range
+	// and Arc of the caster's facing.
+	TargetCone
+	// TargetArea abilities are aimed at a point within Range and hit every
+	// other living character within Radius of it.
+	TargetArea
+)
+
+// Ability is a class's attack or spell. Casting it costs Cost energy and
+// starts its Cooldown at once; it lands CastTime seconds later, dealing
+// Damage of the caster's damage type and applying Applies, if set, to the
+// target. Abilities with a ProjectileSpeed instead launch a Projectile at
+// the target when the cast completes, and land on whatever it hits. Arc is
+// the full width of a cone in radians.
+type Ability struct {
+	Name      string
+	Cooldown  float64
+	CastTime  float64
+	Range     float64
+	Targeting Targeting
+	Cost      float64
+	Damage    float64
+	Applies   Effect
+	Arc       float64
+	Radius    float64
+
+	ProjectileSpeed  float64
+	ProjectileRadius float64
+}
+
+// Cast is an ability under way. X and Y are the point it is aimed at, for
+// abilities cast with CastAt.
+type Cast struct {
+	Ability   Ability
+	Target    Character
+	X, Y      float64
+	Remaining float64
+}
+
+var (
+	ErrUnknownAbility = errors.New("unknown ability")
+	ErrCannotAct      = errors.New("character cannot act")
+	ErrCasting        = errors.New("already casting")
+	ErrOnCooldown     = errors.New("ability is on cooldown")
+	ErrNoEnergy       = errors.New("not enough energy")
+)
+
+const (
+	maxEnergy   = 100
+	energyRegen = 10
+	// castEpsilon absorbs the rounding of summed tick lengths, so a cast
+	// lands on the tick its cast time elapses.
+	castEpsilon = 1e-9
+)
+
+var warriorAbilities = []Ability{
+	{Name: "slash", Cooldown: 0.6, Range: 250, Damage: 20},
+	{Name: "shield_bash", Cooldown: 6, CastTime: 0.25, Range: 150, Cost: 30, Damage: 10,
+		Applies: Effect{Kind: EffectStun, Remaining: 1}},
+	{Name: "cleave", Cooldown: 4, Range: 200, Targeting: TargetCone, Arc: math.Pi / 2, Cost: 25, Damage: 15},
+}
+
+var mageAbilities = []Ability{
+	{Name: "fireball", Cooldown: 0.8, Range: 450, Cost: 10, Damage: 30,
+		Applies:         Effect{Kind: EffectBurn, Magnitude: 4, Remaining: 2},
+		ProjectileSpeed: 600, ProjectileRadius: 8},
+	{Name: "frostbolt", Cooldown: 5, CastTime: 0.5, Range: 400, Cost: 35, Damage: 15,
+		Applies: Effect{Kind: EffectSlow, Magnitude: 0.5, Remaining: 3}},
+	{Name: "blast", Cooldown: 8, CastTime: 0.75, Range: 400, Targeting: TargetArea, Radius: 120, Cost: 40, Damage: 25},
+}
+
+// Abilities lists the character's abilities, primary first.
+func (bc *BaseCharacter) Abilities() []Ability { return nil }
+
+func (bc *BaseCharacter) Energy() float64 { return bc.energy }
+
+// Cooldown returns the seconds until the named ability can be cast again.
+func (bc *BaseCharacter) Cooldown(name string) float64 { return bc.cooldowns[name] }
+
+// Cast starts casting a at target, which is ignored for TargetSelf
+// abilities, and turns the character towards it. Range and target checks
+// are up to the caller.
+func (bc *BaseCharacter) Cast(a Ability, target Character) error {
+	if err := bc.begin(a, Cast{Target: target}); err != nil {
+		return err
+	}
+	if target != nil {
+		x, y := target.Position()
+		bc.Face(x-bc.x, y-bc.y)
+	}
+	return nil
+}
+
+// CastAt starts casting a at the point (x, y) and turns the character
+// towards it. Range checks are up to the caller.
+func (bc *BaseCharacter) CastAt(a Ability, x, y float64) error {
+	if err := bc.begin(a, Cast{X: x, Y: y}); err != nil {
+		return err
+	}
+	bc.Face(x-bc.x, y-bc.y)
+	return nil
+}
+
+func (bc *BaseCharacter) begin(a Ability, cast Cast) error {
+	switch {
+	case !bc.canAct():
+		return ErrCannotAct
+	case bc.casting != nil:
+		return ErrCasting
+	case bc.cooldowns[a.Name] > 0:
+		return ErrOnCooldown
+	case bc.energy < a.Cost:
+		return ErrNoEnergy
+	}
+	if bc.cooldowns == nil {
+		bc.cooldowns = make(map[string]float64)
+	}
+	bc.cooldowns[a.Name] = a.Cooldown
+	bc.energy -= a.Cost
+	bc.lastCast = &a
+	cast.Ability, cast.Remaining = a, a.CastTime
+	bc.casting = &cast
+	bc.state = StateAttacking
+	bc.attackTimer = a.CastTime + 0.3
+	return nil
+}
+
+// CompletedCast returns the cast that finished during the last Update, once.
+func (bc *BaseCharacter) CompletedCast() (Cast, bool) {
+	if bc.casting == nil || bc.casting.Remaining > castEpsilon {
+		return Cast{}, false
+	}
+	c := *bc.casting
+	bc.casting = nil
+	return c, true
+}
+
+// updateAbilities counts cooldowns and the current cast down and
+// regenerates energy. Dying interrupts casting.
+func (bc *BaseCharacter) updateAbilities(dt float64) {
+	for name, left := range bc.cooldowns {
+		if left -= dt; left > 0 {
+			bc.cooldowns[name] = left
+		} else {
+			delete(bc.cooldowns, name)
+		}
+	}
+	bc.energy = min(bc.energy+energyRegen*dt, maxEnergy)
+	if bc.casting == nil {
+		return
+	}
+	if !bc.canAct() {
+		bc.casting = nil
+		return
+	}
+	bc.casting.Remaining -= dt
+}
+
+func (bc *BaseCharacter) Attack(targets []Character) { bc.attack(targets, Ability{}) }
+
+// attack lands the ability the character last cast, or primary if it has
+// not cast one yet, on every living target. Picking the targets, and any
+// cooldown or range checks, is up to the caller.
+func (bc *BaseCharacter) attack(targets []Character, primary Ability) {
+	if !bc.canAct() {
+		return
+	}
+	a := primary
+	if bc.lastCast != nil {
+		a = *bc.lastCast
+	}
+	bc.state = StateAttacking
+	bc.attackTimer = max(bc.attackTimer, 0.3)
+	for _, t := range targets {
+		if !t.IsDead() {
+			land(bc.id, a, bc.damageType, t)
+		}
+	}
+}
+
+// Hit is an ability landing on a character.
+type Hit struct {
+	Caster, Target string
+	Ability        string
+	Damage         float64
+	Killed         bool
+}
+
+// resolve lands cast on its targets: the target unless it died or, for
+// enemy abilities, moved out of range while it was being cast, or everyone
+// in the cone or area, whom the caster then attacks. Projectile abilities
+// are launched instead and land later, if at all.
+func (wd *World) resolve(caster Character, cast Cast) []Hit {
+	a, target := cast.Ability, cast.Target
+	switch {
+	case a.ProjectileSpeed > 0:
+		wd.launch(caster, cast)
+		return nil
+	case a.Targeting == TargetCone || a.Targeting == TargetArea:
+		targets := wd.inside(caster, cast)
+		before := make([]float64, len(targets))
+		for i, t := range targets {
+			before[i] = t.Health()
+		}
+		caster.Attack(targets)
+		hits := make([]Hit, 0, len(targets))
+		for i, t := range targets {
+			hits = append(hits, Hit{
+				Caster:  caster.ID(),
+				Target:  t.ID(),
+				Ability: a.Name,
+				Damage:  before[i] - t.Health(),
+				Killed:  t.IsDead(),
+			})
+		}
+		return hits
+	case a.Targeting == TargetSelf:
+		target = caster
+	}
+	if target == nil || target.IsDead() {
+		return nil
+	}
+	if a.Targeting == TargetEnemy && Distance(caster, target) > a.Range {
+		return nil
+	}
+	return []Hit{land(caster.ID(), a, caster.DamageType(), target)}
+}
+
+// inside returns the living characters other than caster in the cone or
+// area of cast.
+func (wd *World) inside(caster Character, cast Cast) []Character {
+	a := cast.Ability
+	x, y := caster.Position()
+	fx, fy := caster.Facing()
+	var in []Character
+	for _, c := range wd.Characters {
+		if c == caster || c.IsDead() {
+			continue
+		}
+		cx, cy := c.Position()
+		if a.Targeting == TargetArea {
+			if math.Hypot(cx-cast.X, cy-cast.Y) <= a.Radius {
+				in = append(in, c)
+			}
+			continue
+		}
+		d := math.Hypot(cx-x, cy-y)
+		if d > a.Range {
+			continue
+		}
+		// Characters standing on the caster are always in front of it.
+		if d == 0 || ((cx-x)*fx+(cy-y)*fy)/d >= math.Cos(a.Arc/2) {
+			in = append(in, c)
+		}
+	}
+	return in
+}
+
+func land(caster string, a Ability, dt DamageType, target Character) Hit {
+	before := target.Health()
+	if a.Damage > 0 {
+		target.TakeDamage(a.Damage, dt)
+	}
+	if a.Applies.Kind != "" {
+		target.AddEffect(a.Applies)
+	}
+	return Hit{
+		Caster:  caster,
+		Target:  target.ID(),
+		Ability: a.Name,
+		Damage:  before - target.Health(),
+		Killed:  target.IsDead(),
+	}
+}
+
+func Distance(a, b Character) float64 {
+	ax, ay := a.Position()
+	bx, by := b.Position()
+	return math.Hypot(bx-ax, by-ay)
+}
@@ -28,10 +28,20 @@ type Character interface {
 	State() CharacterState
 	SetState(CharacterState)
 	Attack([]Character)
-	MoveStep(float64, float64)
+	SetDirection(float64, float64)
+	Facing() (float64, float64)
+	Face(float64, float64)
+	Velocity() (float64, float64)
+	SetPosition(float64, float64)
+	AddEffect(Effect)
+	Effects() []Effect
+	Abilities() []Ability
+	Cast(Ability, Character) error
+	CastAt(Ability, float64, float64) error
+	CompletedCast() (Cast, bool)
+	Energy() float64
+	Cooldown(string) float64
 	TakeDamage(float64, DamageType)
-	AttackPower() float64
-	AttackRadius() float64
 	Update(float64)
 	FlashRed() bool
 }
@@ -48,8 +58,26 @@ type BaseCharacter struct {
 	hitTimer    float64
 	flashRedOn  bool
 	noMoveTimer float64
+	dirX, dirY  float64
+	// faceX, faceY is the unit vector the character faces, or zero for
+	// the default of facing right.
+	faceX, faceY float64
+	// hasDest is set while heading for (destX, destY) after MoveTo.
+	hasDest      bool
+	destX, destY float64
+	effects      []Effect
+	energy       float64
+	cooldowns    map[string]float64
+	casting      *Cast
+	// lastCast is the ability Attack lands, once the character has cast
+	// one.
+	lastCast *Ability
 }
 
+// moveHold is how long a character keeps moving in the last direction it
+// was given without being given one again.
+const moveHold = 0.5
+
 func (bc *BaseCharacter) ID() string                   { return bc.id }
 func (bc *BaseCharacter) Position() (float64, float64) { return bc.x, bc.y }
 func (bc *BaseCharacter) Health() float64              { return bc.health }
@@ -59,18 +87,66 @@ func (bc *BaseCharacter) State() CharacterState        { return bc.state }
 func (bc *BaseCharacter) SetState(s CharacterState)    { bc.state = s }
 func (bc *BaseCharacter) FlashRed() bool               { return bc.flashRedOn }
 
-func (bc *BaseCharacter) MoveStep(dx, dy float64) {
+// SetDirection makes the character run along (dx, dy) at its full speed,
+// or stop for a zero vector. Only the direction of the vector matters.
+func (bc *BaseCharacter) SetDirection(dx, dy float64) {
 	if bc.isDead || bc.state == StateDying {
 		return
 	}
+	bc.noMoveTimer = 0
+	bc.hasDest = false
 	dist := math.Hypot(dx, dy)
 	if dist < 0.0001 {
+		bc.stop()
 		return
 	}
-	bc.x += (dx / dist) * bc.speed
-	bc.y += (dy / dist) * bc.speed
+	bc.dirX, bc.dirY = dx/dist, dy/dist
+	if bc.casting == nil {
+		bc.faceX, bc.faceY = bc.dirX, bc.dirY
+	}
 	bc.state = StateRunning
-	bc.noMoveTimer = 0
+}
+
+// Facing returns the unit vector the character faces. It turns to where it
+// runs, except while casting, and to what it casts at.
+func (bc *BaseCharacter) Facing() (float64, float64) {
+	if bc.faceX == 0 && bc.faceY == 0 {
+		return 1, 0
+	}
+	return bc.faceX, bc.faceY
+}
+
+// Face turns the character along (dx, dy). A zero vector is ignored.
+func (bc *BaseCharacter) Face(dx, dy float64) {
+	if dist := math.Hypot(dx, dy); dist >= 0.0001 {
+		bc.faceX, bc.faceY = dx/dist, dy/dist
+	}
+}
+
+// MoveTo makes the character run to (x, y) and stop there.
+func (bc *BaseCharacter) MoveTo(x, y float64) {
+	bc.SetDirection(x-bc.x, y-bc.y)
+	if bc.moving() {
+		bc.hasDest, bc.destX, bc.destY = true, x, y
+	}
+}
+
+// Velocity is the character's movement in units per second, after
+// effects.
+func (bc *BaseCharacter) Velocity() (float64, float64) {
+	if !bc.canAct() {
+		return 0, 0
+	}
+	speed := bc.speed * bc.speedFactor()
+	return bc.dirX * speed, bc.dirY * speed
+}
+
+func (bc *BaseCharacter) SetPosition(x, y float64) {
+	bc.x, bc.y = x, y
+}
+
+func (bc *BaseCharacter) moving() bool {
+	return bc.dirX != 0 || bc.dirY != 0
 }
 
 func (bc *BaseCharacter) TakeDamage(amt float64, dt DamageType) {
@@ -86,11 +162,10 @@ func (bc *BaseCharacter) TakeDamage(amt float64, dt DamageType) {
 	}
 }
 
-func (bc *BaseCharacter) Attack([]Character)    {}
-func (bc *BaseCharacter) AttackPower() float64  { return 0 }
-func (bc *BaseCharacter) AttackRadius() float64 { return 0 }
-
 func (bc *BaseCharacter) Update(dt float64) {
+	bc.updateEffects(dt)
+	bc.updateAbilities(dt)
+
 	if bc.isDead && bc.state != StateDying {
 		bc.state = StateDying
 	}
@@ -99,6 +174,9 @@ func (bc *BaseCharacter) Update(dt float64) {
 		bc.attackTimer -= dt
 		if bc.attackTimer <= 0 {
 			bc.state = StateIdle
+			if bc.moving() {
+				bc.state = StateRunning
+			}
 			bc.attackTimer = 0
 		}
 	}
@@ -111,10 +189,24 @@ func (bc *BaseCharacter) Update(dt float64) {
 		}
 	}
 
-	if bc.state == StateRunning {
+	switch {
+	case bc.hasDest:
+		if (bc.destX-bc.x)*bc.dirX+(bc.destY-bc.y)*bc.dirY <= 0 {
+			bc.x, bc.y = bc.destX, bc.destY
+			bc.stop()
+		}
+	case bc.moving():
 		bc.noMoveTimer += dt
-		if bc.noMoveTimer >= 0.5 {
-			bc.state = StateIdle
+		if bc.noMoveTimer >= moveHold {
+			bc.stop()
 		}
 	}
 }
+
+func (bc *BaseCharacter) stop() {
+	bc.dirX, bc.dirY = 0, 0
+	bc.hasDest = false
+	if bc.state == StateRunning {
+		bc.state = StateIdle
+	}
+}
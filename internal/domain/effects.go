@@ -0,0 +1,126 @@
+package domain
+
+type EffectKind string
+
+const (
+	EffectSlow  EffectKind = "slow"
+	EffectStun  EffectKind = "stun"
+	EffectBurn  EffectKind = "burn"
+	EffectHaste EffectKind = "haste"
+)
+
+// EffectKinds lists every effect kind in a stable order.
+var EffectKinds = []EffectKind{EffectSlow, EffectStun, EffectBurn, EffectHaste}
+
+// maxStacks bounds how many effects of one kind a character carries at
+// once. Another one replaces the stack closest to expiring.
+const maxStacks = 3
+
+// Effect is a timed status on a character. Magnitude depends on the kind:
+// the fraction of speed lost to a slow or gained from haste, and the damage
+// per second of a burn. Stuns ignore it. Stacks of the same kind combine:
+// speed factors multiply and burns add up.
+type Effect struct {
+	Kind      EffectKind
+	Magnitude float64
+	Remaining float64
+}
+
+func (bc *BaseCharacter) AddEffect(e Effect) {
+	if bc.isDead || bc.state == StateDying || e.Remaining <= 0 {
+		return
+	}
+	if e.Kind == EffectStun {
+		bc.casting = nil
+	}
+	stacks, weakest := 0, -1
+	for i, have := range bc.effects {
+		if have.Kind != e.Kind {
+			continue
+		}
+		stacks++
+		if weakest < 0 || have.Remaining < bc.effects[weakest].Remaining {
+			weakest = i
+		}
+	}
+	if stacks >= maxStacks {
+		bc.effects[weakest] = e
+		return
+	}
+	bc.effects = append(bc.effects, e)
+}
+
+// ApplySlow reduces speed by factor, e.g. 0.5 for half speed.
+func (bc *BaseCharacter) ApplySlow(factor, duration float64) {
+	bc.AddEffect(Effect{Kind: EffectSlow, Magnitude: factor, Remaining: duration})
+}
+
+// ApplyHaste increases speed by factor, e.g. 0.5 for one and a half times.
+func (bc *BaseCharacter) ApplyHaste(factor, duration float64) {
+	bc.AddEffect(Effect{Kind: EffectHaste, Magnitude: factor, Remaining: duration})
+}
+
+// ApplyBurn deals dps damage per second, ignoring resistances.
+func (bc *BaseCharacter) ApplyBurn(dps, duration float64) {
+	bc.AddEffect(Effect{Kind: EffectBurn, Magnitude: dps, Remaining: duration})
+}
+
+// ApplyStun stops the character from moving and attacking, and interrupts
+// its cast.
+func (bc *BaseCharacter) ApplyStun(duration float64) {
+	bc.AddEffect(Effect{Kind: EffectStun, Remaining: duration})
+}
+
+// Effects returns a copy of the active effects.
+func (bc *BaseCharacter) Effects() []Effect {
+	if len(bc.effects) == 0 {
+		return nil
+	}
+	return append([]Effect(nil), bc.effects...)
+}
+
+func (bc *BaseCharacter) Stunned() bool {
+	for _, e := range bc.effects {
+		if e.Kind == EffectStun {
+			return true
+		}
+	}
+	return false
+}
+
+// canAct reports whether the character may move or attack.
+func (bc *BaseCharacter) canAct() bool {
+	return !bc.isDead && bc.state != StateDying && !bc.Stunned()
+}
+
+func (bc *BaseCharacter) speedFactor() float64 {
+	f := 1.0
+	for _, e := range bc.effects {
+		switch e.Kind {
+		case EffectSlow:
+			f *= max(1-e.Magnitude, 0)
+		case EffectHaste:
+			f *= 1 + e.Magnitude
+		}
+	}
+	return f
+}
+
+// updateEffects applies burns for dt seconds and drops expired effects.
+func (bc *BaseCharacter) updateEffects(dt float64) {
+	n := 0
+	for _, e := range bc.effects {
+		if e.Kind == EffectBurn {
+			bc.TakeDamage(e.Magnitude*min(dt, e.Remaining), Unset)
+		}
+		e.Remaining -= dt
+		if e.Remaining > 0 {
+			bc.effects[n] = e
+			n++
+		}
+	}
+	bc.effects = bc.effects[:n]
+	if bc.isDead {
+		bc.effects = nil
+	}
+}
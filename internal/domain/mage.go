@@ -1,12 +1,8 @@
 package domain
 
-import "fmt"
-
 type Mage struct {
 	BaseCharacter
-	power  float64
-	radius float64
-	res    float64
+	res float64
 }
 
 func NewMage(id string, x, y float64) *Mage {
@@ -16,28 +12,12 @@ func NewMage(id string, x, y float64) *Mage {
 			health:     80,
 			x:          x,
 			y:          y,
-			speed:      7,
+			speed:      420,
 			damageType: Magical,
 			state:      StateIdle,
+			energy:     maxEnergy,
 		},
-		power:  30,
-		radius: 450,
-		res:    0.3,
-	}
-}
-
-func (m *Mage) Attack(targets []Character) {
-	if m.isDead || m.state == StateDying {
-		return
-	}
-	m.state = StateAttacking
-	m.attackTimer = 0.3
-	for _, t := range targets {
-		if t.IsDead() {
-			continue
-		}
-		t.TakeDamage(m.power, Magical)
-		fmt.Printf("%s mage attacked %s\n", m.id, t.ID())
+		res: 0.3,
 	}
 }
 
@@ -48,5 +28,6 @@ func (m *Mage) TakeDamage(a float64, dt DamageType) {
 	m.BaseCharacter.TakeDamage(a, dt)
 }
 
-func (m *Mage) AttackPower() float64  { return m.power }
-func (m *Mage) AttackRadius() float64 { return m.radius }
+func (m *Mage) Attack(targets []Character) { m.attack(targets, mageAbilities[0]) }
+
+func (m *Mage) Abilities() []Ability { return mageAbilities }
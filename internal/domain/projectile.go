@@ -0,0 +1,107 @@
+package domain
+
+import "math"
+
+// characterRadius is the size of a character for projectile collisions.
+const characterRadius = 24
+
+// Projectile is an ability in flight, such as a fireball. It flies in a
+// straight line until it touches a character other than its owner, leaves
+// the world or its lifetime runs out, and on contact lands its ability on
+// that character.
+type Projectile struct {
+	ID         uint64
+	Owner      string
+	Ability    Ability
+	DamageType DamageType
+	X, Y       float64
+	VX, VY     float64
+	Radius     float64
+	Remaining  float64
+}
+
+// launch fires cast's ability from caster towards the target's current
+// position. The projectile flies as far as the ability's range.
+func (wd *World) launch(caster Character, cast Cast) {
+	a := cast.Ability
+	x, y := caster.Position()
+	var vx, vy float64
+	if cast.Target != nil {
+		tx, ty := cast.Target.Position()
+		if d := math.Hypot(tx-x, ty-y); d > 0 {
+			vx, vy = (tx-x)/d*a.ProjectileSpeed, (ty-y)/d*a.ProjectileSpeed
+		}
+	}
+	wd.nextProjectileID++
+	wd.Projectiles = append(wd.Projectiles, &Projectile{
+		ID:         wd.nextProjectileID,
+		Owner:      caster.ID(),
+		Ability:    a,
+		DamageType: caster.DamageType(),
+		X:          x,
+		Y:          y,
+		VX:         vx,
+		VY:         vy,
+		Radius:     a.ProjectileRadius,
+		Remaining:  a.Range / a.ProjectileSpeed,
+	})
+}
+
+// updateProjectiles moves every projectile dt seconds along its path and
+// lands those that touched a character on the way.
+func (wd *World) updateProjectiles(dt float64) []Hit {
+	var hits []Hit
+	n := 0
+	for _, p := range wd.Projectiles {
+		x0, y0 := p.X, p.Y
+		step := min(dt, p.Remaining)
+		p.X += p.VX * step
+		p.Y += p.VY * step
+		p.Remaining -= dt
+
+		if target := wd.struck(p, x0, y0); target != nil {
+			hits = append(hits, land(p.Owner, p.Ability, p.DamageType, target))
+			continue
+		}
+		if p.Remaining <= 0 || p.X < 0 || p.X > wd.Width || p.Y < 0 || p.Y > wd.Height {
+			continue
+		}
+		wd.Projectiles[n] = p
+		n++
+	}
+	clear(wd.Projectiles[n:])
+	wd.Projectiles = wd.Projectiles[:n]
+	return hits
+}
+
+// struck returns the living character closest to (x0, y0) that p touched
+// moving from there to its current position, or nil.
+func (wd *World) struck(p *Projectile, x0, y0 float64) Character {
+	var hit Character
+	best := math.Inf(1)
+	reach := p.Radius + characterRadius
+	for _, c := range wd.Characters {
+		if c.ID() == p.Owner || c.IsDead() {
+			continue
+		}
+		cx, cy := c.Position()
+		if segmentDistance(cx, cy, x0, y0, p.X, p.Y) > reach {
+			continue
+		}
+		if d := math.Hypot(cx-x0, cy-y0); d < best {
+			hit, best = c, d
+		}
+	}
+	return hit
+}
+
+// segmentDistance is the distance from (px, py) to the segment from
+// (x0, y0) to (x1, y1).
+func segmentDistance(px, py, x0, y0, x1, y1 float64) float64 {
+	dx, dy := x1-x0, y1-y0
+	t := 0.0
+	if l2 := dx*dx + dy*dy; l2 > 0 {
+		t = max(0, min(1, ((px-x0)*dx+(py-y0)*dy)/l2))
+	}
+	return math.Hypot(px-(x0+t*dx), py-(y0+t*dy))
+}
@@ -3,9 +3,12 @@ package domain
 import "math/rand"
 
 type World struct {
-	Characters map[string]Character
-	Width      float64
-	Height     float64
+	Characters  map[string]Character
+	Projectiles []*Projectile
+	Width       float64
+	Height      float64
+
+	nextProjectileID uint64
 }
 
 func NewWorld(w, h float64) *World {
@@ -26,9 +29,37 @@ func (wd *World) SpawnRandomCharacter(id string) {
 	}
 }
 
-func (wd *World) Update() {
-	dt := 1.0 / 60.0
+func clamp(v, minV, maxV float64) float64 {
+	if v < minV {
+		return minV
+	}
+	if v > maxV {
+		return maxV
+	}
+	return v
+}
+
+// Update advances the world by dt seconds: characters move at their
+// velocity and are then clamped to the world bounds, and finished casts
+// land or launch projectiles, which then fly. It returns the hits that
+// landed.
+func (wd *World) Update(dt float64) []Hit {
+	var hits []Hit
 	for _, c := range wd.Characters {
+		wd.move(c, dt)
 		c.Update(dt)
+		if cast, ok := c.CompletedCast(); ok {
+			hits = append(hits, wd.resolve(c, cast)...)
+		}
+	}
+	return append(hits, wd.updateProjectiles(dt)...)
+}
+
+func (wd *World) move(c Character, dt float64) {
+	vx, vy := c.Velocity()
+	if vx == 0 && vy == 0 {
+		return
 	}
+	x, y := c.Position()
+	c.SetPosition(clamp(x+vx*dt, 0, wd.Width), clamp(y+vy*dt, 0, wd.Height))
 }
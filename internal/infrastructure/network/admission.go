@@ -0,0 +1,173 @@
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	errServerFull      = errors.New("server is full")
+	errTooManyFromHost = errors.New("too many connections from your address")
+)
+
+// waiter is a connection in the join queue.
+type waiter struct {
+	id    string
+	ready chan admission
+	// moved is signalled whenever the waiter's position may have changed.
+	moved chan struct{}
+}
+
+type admission struct {
+	sess *session
+	err  error
+}
+
+func remoteHost(c net.Conn) string {
+	addr := c.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// addHost counts a connection from host for the per-address limit. It is
+// counted from accept to close, whether it plays, spectates or waits.
+func (s *Server) addHost(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hosts[host]++
+}
+
+func (s *Server) removeHost(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hosts[host]--; s.hosts[host] <= 0 {
+		delete(s.hosts, host)
+	}
+}
+
+// roomFull reports whether a new player has to wait. Newcomers also wait
+// while anyone is queued so the queue stays first come, first served. s.mu
+// must be held.
+func (s *Server) roomFull() bool {
+	return s.cfg.MaxPlayers > 0 && (len(s.sessions) >= s.cfg.MaxPlayers || len(s.queue) > 0)
+}
+
+// reserveSpectator creates a session without a character. s.mu must be
+// held.
+func (s *Server) reserveSpectator() *session {
+	var id string
+	for {
+		s.nextID++
+		id = fmt.Sprintf("spectator-%04d", s.nextID)
+		if _, taken := s.spectators[id]; !taken {
+			break
+		}
+	}
+	sess := &session{id: id, spectator: true}
+	s.spectators[id] = sess
+	return sess
+}
+
+// enqueue adds a player asking for id to the join queue. s.mu must be held.
+func (s *Server) enqueue(id string) *waiter {
+	w := &waiter{id: id, ready: make(chan admission, 1), moved: make(chan struct{}, 1)}
+	s.queue = append(s.queue, w)
+	return w
+}
+
+// admitWaiting hands free slots to the head of the queue. s.mu must be
+// held.
+func (s *Server) admitWaiting() {
+	if len(s.queue) == 0 {
+		return
+	}
+	for len(s.queue) > 0 && !s.closing && len(s.sessions) < s.cfg.MaxPlayers {
+		w := s.queue[0]
+		s.queue = s.queue[1:]
+		sess, err := s.reserveSession(w.id)
+		w.ready <- admission{sess: sess, err: err}
+	}
+	for _, w := range s.queue {
+		select {
+		case w.moved <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// rejectWaiting empties the queue when the server shuts down. s.mu must be
+// held.
+func (s *Server) rejectWaiting(reason string) {
+	for _, w := range s.queue {
+		w.ready <- admission{err: errors.New(reason)}
+	}
+	s.queue = nil
+}
+
+// queuePosition is 1 for the head of the queue and 0 once w has left it.
+// s.mu must be held.
+func (s *Server) queuePosition(w *waiter) int {
+	for i, q := range s.queue {
+		if q == w {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// leaveQueue removes a waiter whose connection failed, giving back a slot
+// it may have been granted in the meantime.
+func (s *Server) leaveQueue(w *waiter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pos := s.queuePosition(w); pos > 0 {
+		s.queue = append(s.queue[:pos-1], s.queue[pos:]...)
+		s.admitWaiting()
+		return
+	}
+	select {
+	case a := <-w.ready:
+		if a.sess != nil {
+			s.endSession(a.sess)
+		}
+	default:
+	}
+}
+
+// waitForSlot keeps a queued connection informed of its position until it
+// is admitted. The position is repeated every HeartbeatInterval so both
+// sides notice a dead connection.
+func (s *Server) waitForSlot(c net.Conn, e *json.Encoder, w *waiter) (*session, error) {
+	var keepalive <-chan time.Time
+	if s.cfg.HeartbeatInterval > 0 {
+		t := time.NewTicker(s.cfg.HeartbeatInterval)
+		defer t.Stop()
+		keepalive = t.C
+	}
+	sent := 0
+	for {
+		s.mu.Lock()
+		pos := s.queuePosition(w)
+		s.mu.Unlock()
+		if pos > 0 && pos != sent {
+			_ = c.SetWriteDeadline(time.Now().Add(handshakeTimeout))
+			if err := e.Encode(Welcome{Version: ProtocolVersion, QueuePosition: pos}); err != nil {
+				s.leaveQueue(w)
+				return nil, err
+			}
+			sent = pos
+		}
+		select {
+		case a := <-w.ready:
+			return a.sess, a.err
+		case <-w.moved:
+		case <-keepalive:
+			sent = 0
+		}
+	}
+}
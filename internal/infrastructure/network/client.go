@@ -2,73 +2,463 @@ package network
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
 	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrNotConnected is returned by the send methods while the client has no
+// connection, for example while it is reconnecting.
+var ErrNotConnected = errors.New("not connected")
+
+// ClientHandlers are called from the client's reader goroutine, one message
+// at a time. They should return quickly; nil handlers are skipped.
+// Reconnect is called after the connection was re-established; resumed
+// reports whether the server still had the character. Queued reports the
+// position in the server's join queue while Connect, or a reconnect, waits
+// for a free slot.
+type ClientHandlers struct {
+	Snapshot  func(services.WorldSnapshot)
+	Event     func(services.GameEvent)
+	Result    func(CommandResult)
+	Chat      func(ChatMessage)
+	Notice    func(Notice)
+	Reconnect func(resumed bool)
+	Queued    func(position int)
+}
+
 type Client struct {
-	addr string
-	conn net.Conn
-	mu   sync.Mutex
-	ch   chan interface{}
+	cfg       ClientConfig
+	handlers  ClientHandlers
+	id        string
+	token     string
+	spectator bool
+	codec     Codec
+	conn      net.Conn
+	mu        sync.Mutex
+	done      chan struct{}
+	closing   chan struct{}
+	closeOnce sync.Once
+	lastReq   atomic.Uint64
+	inputSeq  atomic.Uint64
+	clock     clockEstimator
 }
 
-func NewClient(a string) *Client {
+func NewClient(cfg ClientConfig, h ClientHandlers) *Client {
 	return &Client{
-		addr: a,
-		ch:   make(chan interface{}, 100),
+		cfg:      cfg,
+		handlers: h,
+		done:     make(chan struct{}),
+		closing:  make(chan struct{}),
 	}
 }
 
 func (c *Client) Connect(ctx context.Context) error {
-	con, err := net.Dial("tcp", c.addr)
+	d, _, err := c.dial(ctx, c.cfg.CharacterID, "")
 	if err != nil {
 		return err
 	}
-	c.conn = con
-	go c.listen(ctx)
+	context.AfterFunc(ctx, c.Close)
+	go c.run(ctx, d)
 	return nil
 }
 
-func (c *Client) listen(ctx context.Context) {
-	defer c.Close()
-	d := json.NewDecoder(c.conn)
+// dial opens a connection and performs the handshake, presenting token when
+// it is not empty.
+func (c *Client) dial(ctx context.Context, id, token string) (Decoder, Welcome, error) {
+	con, err := dialTransport(ctx, c.cfg)
+	if err != nil {
+		return nil, Welcome{}, err
+	}
+	hs := json.NewDecoder(con)
+	// Waiting in the join queue can take a while, so ctx must be able to
+	// interrupt the handshake.
+	stop := context.AfterFunc(ctx, func() { _ = con.Close() })
+	w, err := c.handshake(con, hs, Hello{Version: ProtocolVersion, CharacterID: id, Codecs: c.cfg.Codecs, Compression: c.cfg.Compression, ResumeToken: token})
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		con.Close()
+		return nil, Welcome{}, err
+	}
+	codec, ok := codecByName(w.Codec)
+	if !ok {
+		con.Close()
+		return nil, Welcome{}, fmt.Errorf("server picked unknown codec %q", w.Codec)
+	}
+
+	setFraming(con, codec, w.Compression)
+	in := afterHandshake(hs, con)
+	switch w.Compression {
+	case "":
+	case CompressionDeflate:
+		dc := newDeflateConn(con, afterWelcome(hs, con), nil)
+		con, in = dc, dc
+	default:
+		con.Close()
+		return nil, Welcome{}, fmt.Errorf("server picked unknown compression %q", w.Compression)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.closing:
+		con.Close()
+		return nil, Welcome{}, net.ErrClosed
+	default:
+	}
+	c.id = w.CharacterID
+	c.token = w.ResumeToken
+	c.spectator = w.Spectator
+	c.codec = codec
+	c.conn = con
+	return codec.NewDecoder(in), w, nil
+}
+
+func dialTransport(ctx context.Context, cfg ClientConfig) (net.Conn, error) {
+	addr := cfg.Addr
+	switch {
+	case strings.HasPrefix(addr, "ws://"):
+		return DialWebSocket(ctx, addr, nil)
+	case strings.HasPrefix(addr, "wss://"), strings.HasPrefix(addr, "tls://"):
+		tc, err := clientTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(addr, "wss://") {
+			return DialWebSocket(ctx, addr, tc)
+		}
+		d := tls.Dialer{Config: tc}
+		return d.DialContext(ctx, "tcp", strings.TrimPrefix(addr, "tls://"))
+	case strings.HasPrefix(addr, "udp://"):
+		return DialUDP(ctx, addr)
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+func (c *Client) handshake(con net.Conn, d *json.Decoder, h Hello) (Welcome, error) {
+	_ = con.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer con.SetDeadline(time.Time{})
+
+	if err := json.NewEncoder(con).Encode(h); err != nil {
+		return Welcome{}, err
+	}
+	for {
+		var w Welcome
+		if err := d.Decode(&w); err != nil {
+			return Welcome{}, err
+		}
+		if w.Error != "" {
+			return Welcome{}, fmt.Errorf("%w: %s", ErrHandshakeRejected, w.Error)
+		}
+		if w.QueuePosition == 0 {
+			return w, nil
+		}
+		if c.handlers.Queued != nil {
+			c.handlers.Queued(w.QueuePosition)
+		}
+		// The server repeats the position every heartbeat while we wait.
+		if c.cfg.IdleTimeout > 0 {
+			_ = con.SetDeadline(time.Now().Add(c.cfg.IdleTimeout))
+		} else {
+			_ = con.SetDeadline(time.Time{})
+		}
+	}
+}
+
+// run reads from the connection and, when it drops, reconnects until the
+// client is closed or reconnecting is disabled.
+func (c *Client) run(ctx context.Context, d Decoder) {
+	defer close(c.done)
+	for {
+		stop := make(chan struct{})
+		go c.heartbeat(stop)
+		c.listen(ctx, d)
+		close(stop)
+		c.dropConn()
+		if !c.cfg.Reconnect || c.closed() {
+			return
+		}
+
+		var w Welcome
+		var err error
+		if d, w, err = c.reconnect(ctx); err != nil {
+			return
+		}
+		if c.handlers.Reconnect != nil {
+			c.handlers.Reconnect(w.Resumed)
+		}
+	}
+}
+
+// reconnect retries with exponential backoff and jitter. The resume token
+// is tried first; once the server no longer knows it the client joins again
+// under the same character id.
+func (c *Client) reconnect(ctx context.Context) (Decoder, Welcome, error) {
+	c.mu.Lock()
+	id, token := c.id, c.token
+	c.mu.Unlock()
+
+	backoff := c.cfg.ReconnectMinBackoff
+	for {
+		wait := backoff/2 + time.Duration(rand.Int64N(int64(backoff/2)+1))
+		t := time.NewTimer(wait)
+		select {
+		case <-c.closing:
+			t.Stop()
+			return nil, Welcome{}, net.ErrClosed
+		case <-t.C:
+		}
+
+		d, w, err := c.dial(ctx, id, token)
+		if errors.Is(err, ErrHandshakeRejected) && token != "" {
+			token = ""
+			d, w, err = c.dial(ctx, id, token)
+		}
+		if err == nil {
+			return d, w, nil
+		}
+		if c.closed() {
+			return nil, Welcome{}, err
+		}
+		backoff = min(backoff*2, c.cfg.ReconnectMaxBackoff)
+	}
+}
+
+// heartbeat pings the server until stop is closed.
+func (c *Client) heartbeat(stop <-chan struct{}) {
+	if c.cfg.HeartbeatInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(c.cfg.HeartbeatInterval)
+	defer t.Stop()
 	for {
 		select {
-		case <-ctx.Done():
+		case <-stop:
+			return
+		case <-t.C:
+			_ = c.send(ClientMessage{Kind: ClientPing, Heartbeat: newPing()})
+		}
+	}
+}
+
+// Latency reports the smoothed round-trip time to the server and the
+// client's clock offset from it, in the same sense as the server reports it.
+func (c *Client) Latency() services.Latency {
+	l := c.clock.current()
+	l.ClockOffset = -l.ClockOffset
+	return l
+}
+
+func (c *Client) closed() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Client) CharacterID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id
+}
+
+// Spectator reports whether the server admitted the client as a spectator,
+// without a character, because it was full.
+func (c *Client) Spectator() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.spectator
+}
+
+// CodecName reports the codec negotiated during Connect.
+func (c *Client) CodecName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.codec == nil {
+		return ""
+	}
+	return c.codec.Name()
+}
+
+func (c *Client) listen(ctx context.Context, d Decoder) {
+	received := make(map[uint64]services.WorldSnapshot)
+	for {
+		c.extendReadDeadline()
+		var m ServerMessage
+		if err := d.DecodeServer(&m); err != nil {
 			return
-		default:
 		}
-		var raw interface{}
-		if err := d.Decode(&raw); err != nil {
+		if ctx.Err() != nil {
 			return
 		}
-		c.ch <- raw
+
+		switch m.Kind {
+		case ServerSnapshot:
+			if ws, ok := c.applySnapshot(received, m.Snapshot); ok && c.handlers.Snapshot != nil {
+				c.handlers.Snapshot(ws)
+			}
+		case ServerEvent:
+			if c.handlers.Event != nil && m.Event != nil {
+				c.handlers.Event(*m.Event)
+			}
+		case ServerResult:
+			if c.handlers.Result != nil && m.Result != nil {
+				c.handlers.Result(*m.Result)
+			}
+		case ServerChat:
+			if c.handlers.Chat != nil && m.Chat != nil {
+				c.handlers.Chat(*m.Chat)
+			}
+		case ServerNotice:
+			if c.handlers.Notice != nil && m.Notice != nil {
+				c.handlers.Notice(*m.Notice)
+			}
+		case ServerPing:
+			if m.Heartbeat != nil {
+				_ = c.send(ClientMessage{Kind: ClientPong, Heartbeat: pong(*m.Heartbeat)})
+			}
+		case ServerPong:
+			if m.Heartbeat != nil {
+				c.clock.observe(*m.Heartbeat, time.Now().UnixNano())
+			}
+		}
 	}
 }
 
-func (c *Client) UpdatesChannel() <-chan interface{} {
-	return c.ch
+func (c *Client) extendReadDeadline() {
+	if c.cfg.IdleTimeout <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.cfg.IdleTimeout))
+	}
 }
 
+// applySnapshot rebuilds the world from a full or delta snapshot and
+// acknowledges it.
+func (c *Client) applySnapshot(received map[uint64]services.WorldSnapshot, m *SnapshotMessage) (services.WorldSnapshot, bool) {
+	if m == nil {
+		return services.WorldSnapshot{}, false
+	}
+	var ws services.WorldSnapshot
+	switch {
+	case m.Full != nil:
+		ws = *m.Full
+	case m.Delta != nil:
+		base, ok := received[m.Baseline]
+		if !ok {
+			// Baseline lost: ask the server to start over from a full snapshot.
+			_ = c.send(ClientMessage{Kind: ClientAck, Ack: 0})
+			return services.WorldSnapshot{}, false
+		}
+		ws = services.ApplyDelta(base, *m.Delta)
+	default:
+		return services.WorldSnapshot{}, false
+	}
+
+	received[m.Seq] = ws
+	if m.Seq > snapshotHistorySize {
+		delete(received, m.Seq-snapshotHistorySize)
+	}
+	_ = c.send(ClientMessage{Kind: ClientAck, Ack: m.Seq})
+	return ws, true
+}
+
+// Done is closed once the connection is gone for good: after Close, or when
+// reconnecting is disabled or gave up.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// SendCommand stamps cmd with the next sequence number and sends it.
 func (c *Client) SendCommand(cmd command.DTO) error {
+	_, err := c.SendInput(cmd)
+	return err
+}
+
+// SendInput is SendCommand returning the sequence number cmd was stamped
+// with, which snapshots acknowledge in LastInputSeq once the server has
+// processed it.
+func (c *Client) SendInput(cmd command.DTO) (uint64, error) {
+	cmd.Seq = c.inputSeq.Add(1)
+	return cmd.Seq, c.send(ClientMessage{Kind: ClientCommand, Command: &cmd})
+}
+
+// SendReliableInput is SendInput on the reliable lane. Over UDP a MOVE
+// without a RequestID is otherwise sent once, which suits repeats of the
+// current direction but not a change of it, whose loss the next message
+// would not repair.
+func (c *Client) SendReliableInput(cmd command.DTO) (uint64, error) {
+	cmd.Seq = c.inputSeq.Add(1)
+	return cmd.Seq, c.write(ClientMessage{Kind: ClientCommand, Command: &cmd}, false)
+}
+
+// Request sends cmd with a fresh request ID and returns that ID. The outcome
+// arrives through the Result handler.
+func (c *Client) Request(cmd command.DTO) (uint64, error) {
+	cmd.RequestID = c.lastReq.Add(1)
+	return cmd.RequestID, c.SendCommand(cmd)
+}
+
+func (c *Client) SendChat(text string) error {
+	return c.send(ClientMessage{Kind: ClientChat, Text: text})
+}
+
+func (c *Client) send(m ClientMessage) error {
+	return c.write(m, sendsUnreliably(m))
+}
+
+func (c *Client) write(m ClientMessage, unreliable bool) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.conn == nil {
-		return nil
+		return ErrNotConnected
+	}
+	b, err := c.codec.MarshalClient(m)
+	if err != nil {
+		return err
 	}
-	e := json.NewEncoder(c.conn)
-	return e.Encode(cmd)
+	return writeMessage(c.conn, b, unreliable)
+}
+
+// sendsUnreliably picks the messages that the next one makes obsolete:
+// acks, heartbeats and movement input nobody waits on a result for.
+func sendsUnreliably(m ClientMessage) bool {
+	switch m.Kind {
+	case ClientAck, ClientPing, ClientPong:
+		return true
+	case ClientCommand:
+		return m.Command != nil && m.Command.Type == command.MOVE && m.Command.RequestID == 0
+	}
+	return false
 }
 
 func (c *Client) Close() {
+	c.closeOnce.Do(func() { close(c.closing) })
+	c.dropConn()
+}
+
+func (c *Client) dropConn() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.conn != nil {
 		c.conn.Close()
 		c.conn = nil
-		close(c.ch)
 	}
 }
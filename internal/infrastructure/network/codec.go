@@ -0,0 +1,68 @@
+package network
+
+import (
+	"errors"
+	"io"
+)
+
+// MaxFrameSize caps a single encoded message in either direction.
+const MaxFrameSize = 1 << 20
+
+var (
+	ErrFrameTooLarge  = errors.New("frame exceeds size cap")
+	ErrMalformedFrame = errors.New("malformed frame")
+)
+
+// Codec encodes messages exchanged after the handshake. Hello and Welcome are
+// always JSON so the codec itself can be negotiated.
+type Codec interface {
+	Name() string
+	MarshalClient(ClientMessage) ([]byte, error)
+	MarshalServer(ServerMessage) ([]byte, error)
+	NewDecoder(io.Reader) Decoder
+}
+
+type Decoder interface {
+	DecodeClient(*ClientMessage) error
+	DecodeServer(*ServerMessage) error
+}
+
+var (
+	JSONCodec   Codec = jsonCodec{}
+	BinaryCodec Codec = binaryCodec{}
+)
+
+var codecs = map[string]Codec{
+	JSONCodec.Name():   JSONCodec,
+	BinaryCodec.Name(): BinaryCodec,
+}
+
+// negotiateCodec picks the first codec the client offered that the server
+// supports. Clients that offer nothing get JSON.
+func negotiateCodec(offered []string) (Codec, bool) {
+	if len(offered) == 0 {
+		return JSONCodec, true
+	}
+	for _, name := range offered {
+		if c, ok := codecs[name]; ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// limitFrames lowers the size cap for frames read by d. A larger frame
+// fails with ErrFrameTooLarge.
+func limitFrames(d Decoder, n int) {
+	if l, ok := d.(interface{ setFrameLimit(int) }); ok && n > 0 && n < MaxFrameSize {
+		l.setFrameLimit(n)
+	}
+}
+
+func codecByName(name string) (Codec, bool) {
+	if name == "" {
+		return JSONCodec, true
+	}
+	c, ok := codecs[name]
+	return c, ok
+}
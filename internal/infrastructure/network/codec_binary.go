@@ -0,0 +1,694 @@
+package network
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+)
+
+// Binary frames are a 4-byte big-endian payload length followed by the
+// payload. The first payload byte identifies the message. Snapshots,
+// heartbeats and client messages have a compact encoding; the rarer server
+// messages carry a JSON body.
+const (
+	tagCommand byte = iota + 1
+	tagAck
+	tagSnapshot
+	tagChat
+	tagEvent
+	tagResult
+	tagNotice
+	tagPing
+	tagPong
+)
+
+// Positions and velocities are sent with 1/16 unit precision, health and
+// energy with 1/10, effect magnitudes and durations with 1/100 and facing
+// with 1/100 radian.
+const (
+	positionScale = 16
+	healthScale   = 10
+	effectScale   = 100
+	angleScale    = 100
+)
+
+const (
+	snapshotHasFull byte = 1 << iota
+	snapshotHasDelta
+)
+
+const (
+	fieldClass uint64 = 1 << iota
+	fieldState
+	fieldHealth
+	fieldX
+	fieldY
+	fieldFlash
+	fieldFlashOn
+	fieldPing
+	fieldEffects
+	fieldFacing
+)
+
+type binaryCodec struct{}
+
+func (binaryCodec) Name() string { return "binary" }
+
+func (binaryCodec) MarshalClient(m ClientMessage) ([]byte, error) {
+	w := newFrameWriter()
+	switch m.Kind {
+	case ClientAck:
+		w.byte(tagAck)
+		w.uvarint(m.Ack)
+	case ClientCommand:
+		if m.Command == nil {
+			return nil, ErrMalformedFrame
+		}
+		data, err := json.Marshal(m.Command.Data)
+		if err != nil {
+			return nil, err
+		}
+		w.byte(tagCommand)
+		w.uvarint(uint64(m.Command.Type))
+		w.uvarint(m.Command.RequestID)
+		w.uvarint(m.Command.Seq)
+		w.string(m.Command.CharacterID)
+		w.bytes(data)
+	case ClientChat:
+		w.byte(tagChat)
+		w.string(m.Text)
+	case ClientPing, ClientPong:
+		if m.Heartbeat == nil {
+			return nil, ErrMalformedFrame
+		}
+		w.heartbeat(m.Kind == ClientPing, *m.Heartbeat)
+	default:
+		return nil, ErrMalformedFrame
+	}
+	return w.frame()
+}
+
+func (binaryCodec) MarshalServer(m ServerMessage) ([]byte, error) {
+	w := newFrameWriter()
+	var body interface{}
+	switch {
+	case m.Kind == ServerSnapshot && m.Snapshot != nil:
+		w.byte(tagSnapshot)
+		w.snapshot(*m.Snapshot)
+		return w.frame()
+	case (m.Kind == ServerPing || m.Kind == ServerPong) && m.Heartbeat != nil:
+		w.heartbeat(m.Kind == ServerPing, *m.Heartbeat)
+		return w.frame()
+	case m.Kind == ServerEvent && m.Event != nil:
+		w.byte(tagEvent)
+		body = m.Event
+	case m.Kind == ServerResult && m.Result != nil:
+		w.byte(tagResult)
+		body = m.Result
+	case m.Kind == ServerChat && m.Chat != nil:
+		w.byte(tagChat)
+		body = m.Chat
+	case m.Kind == ServerNotice && m.Notice != nil:
+		w.byte(tagNotice)
+		body = m.Notice
+	default:
+		return nil, ErrMalformedFrame
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	w.buf = append(w.buf, b...)
+	return w.frame()
+}
+
+func (w *frameWriter) heartbeat(ping bool, h Heartbeat) {
+	if ping {
+		w.byte(tagPing)
+	} else {
+		w.byte(tagPong)
+	}
+	w.varint(h.SentAt)
+	w.varint(h.ReplyAt)
+}
+
+func (w *frameWriter) snapshot(m SnapshotMessage) {
+	w.uvarint(m.Seq)
+	w.uvarint(m.Baseline)
+
+	var flags byte
+	if m.Full != nil {
+		flags |= snapshotHasFull
+	}
+	if m.Delta != nil {
+		flags |= snapshotHasDelta
+	}
+	w.byte(flags)
+
+	if m.Full != nil {
+		w.snapshotHeader(m.Full.Tick, m.Full.ServerTime, m.Full.LastInputSeq)
+		w.abilities(m.Full.Abilities, m.Full.Energy)
+		w.projectiles(m.Full.Projectiles)
+		w.characters(m.Full.Characters)
+	}
+	if m.Delta != nil {
+		w.snapshotHeader(m.Delta.Tick, m.Delta.ServerTime, m.Delta.LastInputSeq)
+		w.abilities(m.Delta.Abilities, m.Delta.Energy)
+		w.projectiles(m.Delta.Projectiles)
+		w.characters(m.Delta.Added)
+		w.uvarint(uint64(len(m.Delta.Removed)))
+		for _, id := range m.Delta.Removed {
+			w.string(id)
+		}
+		w.uvarint(uint64(len(m.Delta.Changed)))
+		for _, cd := range m.Delta.Changed {
+			w.characterDelta(cd)
+		}
+		w.uvarint(uint64(len(m.Delta.Despawned)))
+		for _, id := range m.Delta.Despawned {
+			w.string(id)
+		}
+	}
+}
+
+func (binaryCodec) NewDecoder(r io.Reader) Decoder {
+	return &binaryDecoder{r: r, limit: MaxFrameSize}
+}
+
+type binaryDecoder struct {
+	r      io.Reader
+	limit  uint32
+	header [4]byte
+	buf    []byte
+}
+
+// next reads one frame. The length is checked against the size cap before
+// anything is allocated.
+func (d *binaryDecoder) next() (*frameReader, error) {
+	if _, err := io.ReadFull(d.r, d.header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(d.header[:])
+	if n > d.limit {
+		return nil, ErrFrameTooLarge
+	}
+	if n == 0 {
+		return nil, ErrMalformedFrame
+	}
+	if cap(d.buf) < int(n) {
+		d.buf = make([]byte, n)
+	}
+	d.buf = d.buf[:n]
+	if _, err := io.ReadFull(d.r, d.buf); err != nil {
+		return nil, err
+	}
+	return &frameReader{buf: d.buf}, nil
+}
+
+func (d *binaryDecoder) setFrameLimit(n int) {
+	d.limit = uint32(n)
+}
+
+func (d *binaryDecoder) DecodeClient(m *ClientMessage) error {
+	r, err := d.next()
+	if err != nil {
+		return err
+	}
+	*m = ClientMessage{}
+	switch r.byte() {
+	case tagAck:
+		m.Kind = ClientAck
+		m.Ack = r.uvarint()
+	case tagCommand:
+		var dto command.DTO
+		dto.Type = command.Type(r.uvarint())
+		dto.RequestID = r.uvarint()
+		dto.Seq = r.uvarint()
+		dto.CharacterID = r.string()
+		if data := r.bytes(); r.err == nil {
+			if err := json.Unmarshal(data, &dto.Data); err != nil {
+				return ErrMalformedFrame
+			}
+		}
+		m.Kind = ClientCommand
+		m.Command = &dto
+	case tagChat:
+		m.Kind = ClientChat
+		m.Text = r.string()
+	case tagPing:
+		m.Kind, m.Heartbeat = ClientPing, r.heartbeat()
+	case tagPong:
+		m.Kind, m.Heartbeat = ClientPong, r.heartbeat()
+	default:
+		return ErrMalformedFrame
+	}
+	return r.finish()
+}
+
+func (d *binaryDecoder) DecodeServer(m *ServerMessage) error {
+	r, err := d.next()
+	if err != nil {
+		return err
+	}
+	*m = ServerMessage{}
+	var body interface{}
+	switch r.byte() {
+	case tagSnapshot:
+		var s SnapshotMessage
+		r.snapshot(&s)
+		m.Kind, m.Snapshot = ServerSnapshot, &s
+		return r.finish()
+	case tagPing:
+		m.Kind, m.Heartbeat = ServerPing, r.heartbeat()
+		return r.finish()
+	case tagPong:
+		m.Kind, m.Heartbeat = ServerPong, r.heartbeat()
+		return r.finish()
+	case tagEvent:
+		m.Event = &services.GameEvent{}
+		m.Kind, body = ServerEvent, m.Event
+	case tagResult:
+		m.Result = &CommandResult{}
+		m.Kind, body = ServerResult, m.Result
+	case tagChat:
+		m.Chat = &ChatMessage{}
+		m.Kind, body = ServerChat, m.Chat
+	case tagNotice:
+		m.Notice = &Notice{}
+		m.Kind, body = ServerNotice, m.Notice
+	default:
+		return ErrMalformedFrame
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if err := json.Unmarshal(r.buf, body); err != nil {
+		return ErrMalformedFrame
+	}
+	return nil
+}
+
+func (r *frameReader) heartbeat() *Heartbeat {
+	return &Heartbeat{SentAt: r.varint(), ReplyAt: r.varint()}
+}
+
+func (w *frameWriter) snapshotHeader(tick uint64, serverTime int64, lastInput uint64) {
+	w.uvarint(tick)
+	w.varint(serverTime)
+	w.uvarint(lastInput)
+}
+
+func (w *frameWriter) abilities(as []services.AbilityState, energy float64) {
+	w.uvarint(uint64(len(as)))
+	for _, a := range as {
+		w.string(a.Name)
+		w.quantized(a.Cooldown, effectScale)
+	}
+	w.quantized(energy, healthScale)
+}
+
+func (r *frameReader) abilities() ([]services.AbilityState, float64) {
+	n := r.count(minAbilitySize)
+	var as []services.AbilityState
+	if n > 0 {
+		as = make([]services.AbilityState, 0, n)
+	}
+	for range n {
+		as = append(as, services.AbilityState{Name: r.string(), Cooldown: r.quantized(effectScale)})
+	}
+	return as, r.quantized(healthScale)
+}
+
+func (w *frameWriter) projectiles(ps []services.ProjectileSnapshot) {
+	w.uvarint(uint64(len(ps)))
+	for _, p := range ps {
+		w.uvarint(p.ID)
+		w.string(p.Kind)
+		w.string(p.Owner)
+		w.quantized(p.X, positionScale)
+		w.quantized(p.Y, positionScale)
+		w.quantized(p.VX, positionScale)
+		w.quantized(p.VY, positionScale)
+	}
+}
+
+func (r *frameReader) projectiles() []services.ProjectileSnapshot {
+	n := r.count(minProjectileSize)
+	if n == 0 {
+		return nil
+	}
+	ps := make([]services.ProjectileSnapshot, 0, n)
+	for range n {
+		ps = append(ps, services.ProjectileSnapshot{
+			ID:    r.uvarint(),
+			Kind:  r.string(),
+			Owner: r.string(),
+			X:     r.quantized(positionScale),
+			Y:     r.quantized(positionScale),
+			VX:    r.quantized(positionScale),
+			VY:    r.quantized(positionScale),
+		})
+	}
+	if r.err != nil {
+		return nil
+	}
+	return ps
+}
+
+func (r *frameReader) snapshot(m *SnapshotMessage) {
+	m.Seq = r.uvarint()
+	m.Baseline = r.uvarint()
+	flags := r.byte()
+	if flags&snapshotHasFull != 0 {
+		ws := services.WorldSnapshot{Tick: r.uvarint(), ServerTime: r.varint(), LastInputSeq: r.uvarint()}
+		ws.Abilities, ws.Energy = r.abilities()
+		ws.Projectiles = r.projectiles()
+		ws.Characters = r.characters()
+		m.Full = &ws
+	}
+	if flags&snapshotHasDelta != 0 {
+		d := services.SnapshotDelta{Tick: r.uvarint(), ServerTime: r.varint(), LastInputSeq: r.uvarint()}
+		d.Abilities, d.Energy = r.abilities()
+		d.Projectiles = r.projectiles()
+		d.Added = r.characters()
+		if n := r.count(1); n > 0 {
+			d.Removed = make([]string, 0, n)
+			for range n {
+				d.Removed = append(d.Removed, r.string())
+			}
+		}
+		if n := r.count(minCharacterDeltaSize); n > 0 {
+			d.Changed = make([]services.CharacterDelta, 0, n)
+			for range n {
+				d.Changed = append(d.Changed, r.characterDelta())
+			}
+		}
+		if n := r.count(1); n > 0 {
+			d.Despawned = make([]string, 0, n)
+			for range n {
+				d.Despawned = append(d.Despawned, r.string())
+			}
+		}
+		m.Delta = &d
+	}
+}
+
+type frameWriter struct {
+	buf []byte
+}
+
+func newFrameWriter() *frameWriter {
+	return &frameWriter{buf: make([]byte, 4, 256)}
+}
+
+func (w *frameWriter) frame() ([]byte, error) {
+	n := len(w.buf) - 4
+	if n > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	binary.BigEndian.PutUint32(w.buf, uint32(n))
+	return w.buf, nil
+}
+
+func (w *frameWriter) byte(b byte)      { w.buf = append(w.buf, b) }
+func (w *frameWriter) uvarint(v uint64) { w.buf = binary.AppendUvarint(w.buf, v) }
+func (w *frameWriter) varint(v int64)   { w.buf = binary.AppendVarint(w.buf, v) }
+func (w *frameWriter) string(s string)  { w.uvarint(uint64(len(s))); w.buf = append(w.buf, s...) }
+func (w *frameWriter) bytes(b []byte)   { w.uvarint(uint64(len(b))); w.buf = append(w.buf, b...) }
+func (w *frameWriter) quantized(v float64, scale float64) {
+	w.varint(int64(math.Round(v * scale)))
+}
+
+func (w *frameWriter) characters(cs []services.CharacterSnapshot) {
+	w.uvarint(uint64(len(cs)))
+	for _, c := range cs {
+		w.string(c.ID)
+		w.string(c.Class)
+		w.string(c.State)
+		w.quantized(c.Health, healthScale)
+		w.quantized(c.X, positionScale)
+		w.quantized(c.Y, positionScale)
+		if c.Flash {
+			w.byte(1)
+		} else {
+			w.byte(0)
+		}
+		w.quantized(c.Facing, angleScale)
+		w.uvarint(uint64(max(c.Ping, 0)))
+		w.effects(c.Effects)
+	}
+}
+
+func (w *frameWriter) effects(es []services.EffectSnapshot) {
+	w.uvarint(uint64(len(es)))
+	for _, e := range es {
+		w.string(e.Kind)
+		w.quantized(e.Magnitude, effectScale)
+		w.quantized(e.Remaining, effectScale)
+	}
+}
+
+func (w *frameWriter) characterDelta(d services.CharacterDelta) {
+	var mask uint64
+	if d.Class != nil {
+		mask |= fieldClass
+	}
+	if d.State != nil {
+		mask |= fieldState
+	}
+	if d.Health != nil {
+		mask |= fieldHealth
+	}
+	if d.X != nil {
+		mask |= fieldX
+	}
+	if d.Y != nil {
+		mask |= fieldY
+	}
+	if d.Flash != nil {
+		mask |= fieldFlash
+		if *d.Flash {
+			mask |= fieldFlashOn
+		}
+	}
+	if d.Ping != nil {
+		mask |= fieldPing
+	}
+	if d.Effects != nil {
+		mask |= fieldEffects
+	}
+	if d.Facing != nil {
+		mask |= fieldFacing
+	}
+	w.string(d.ID)
+	w.uvarint(mask)
+	if d.Class != nil {
+		w.string(*d.Class)
+	}
+	if d.State != nil {
+		w.string(*d.State)
+	}
+	if d.Health != nil {
+		w.quantized(*d.Health, healthScale)
+	}
+	if d.X != nil {
+		w.quantized(*d.X, positionScale)
+	}
+	if d.Y != nil {
+		w.quantized(*d.Y, positionScale)
+	}
+	if d.Ping != nil {
+		w.uvarint(uint64(max(*d.Ping, 0)))
+	}
+	if d.Effects != nil {
+		w.effects(*d.Effects)
+	}
+	if d.Facing != nil {
+		w.quantized(*d.Facing, angleScale)
+	}
+}
+
+// frameReader parses a payload. The first error sticks and every later read
+// returns a zero value, so callers only check err once via finish.
+type frameReader struct {
+	buf []byte
+	err error
+}
+
+func (r *frameReader) fail() {
+	if r.err == nil {
+		r.err = ErrMalformedFrame
+	}
+	r.buf = nil
+}
+
+func (r *frameReader) finish() error {
+	if r.err == nil && len(r.buf) != 0 {
+		return ErrMalformedFrame
+	}
+	return r.err
+}
+
+func (r *frameReader) byte() byte {
+	if len(r.buf) < 1 {
+		r.fail()
+		return 0
+	}
+	b := r.buf[0]
+	r.buf = r.buf[1:]
+	return b
+}
+
+func (r *frameReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *frameReader) varint() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+// count reads a collection length. Every element takes at least minSize
+// bytes, so a count that cannot fit in the rest of the frame is malformed.
+// This keeps allocations proportional to the frame rather than to whatever
+// the sender claims.
+func (r *frameReader) count(minSize int) int {
+	n := r.uvarint()
+	if n > uint64(len(r.buf)/minSize) {
+		r.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (r *frameReader) bytes() []byte {
+	n := r.count(1)
+	if r.err != nil {
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *frameReader) string() string {
+	return string(r.bytes())
+}
+
+func (r *frameReader) quantized(scale float64) float64 {
+	return float64(r.varint()) / scale
+}
+
+// Smallest possible encodings, used to bound collection counts.
+const (
+	minCharacterSize      = 10
+	minCharacterDeltaSize = 2
+	minEffectSize         = 3
+	minAbilitySize        = 2
+	minProjectileSize     = 7
+)
+
+func (r *frameReader) characters() []services.CharacterSnapshot {
+	n := r.count(minCharacterSize)
+	if n == 0 {
+		return nil
+	}
+	cs := make([]services.CharacterSnapshot, 0, n)
+	for range n {
+		c := services.CharacterSnapshot{
+			ID:     r.string(),
+			Class:  r.string(),
+			State:  r.string(),
+			Health: r.quantized(healthScale),
+			X:      r.quantized(positionScale),
+			Y:      r.quantized(positionScale),
+			Flash:  r.byte() != 0,
+			Facing: r.quantized(angleScale),
+			Ping:   int(r.uvarint()),
+		}
+		c.Effects = r.effects()
+		if r.err != nil {
+			return nil
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+func (r *frameReader) effects() []services.EffectSnapshot {
+	n := r.count(minEffectSize)
+	if n == 0 {
+		return nil
+	}
+	es := make([]services.EffectSnapshot, 0, n)
+	for range n {
+		es = append(es, services.EffectSnapshot{
+			Kind:      r.string(),
+			Magnitude: r.quantized(effectScale),
+			Remaining: r.quantized(effectScale),
+		})
+	}
+	if r.err != nil {
+		return nil
+	}
+	return es
+}
+
+func (r *frameReader) characterDelta() services.CharacterDelta {
+	d := services.CharacterDelta{ID: r.string()}
+	mask := r.uvarint()
+	if mask&fieldClass != 0 {
+		v := r.string()
+		d.Class = &v
+	}
+	if mask&fieldState != 0 {
+		v := r.string()
+		d.State = &v
+	}
+	if mask&fieldHealth != 0 {
+		v := r.quantized(healthScale)
+		d.Health = &v
+	}
+	if mask&fieldX != 0 {
+		v := r.quantized(positionScale)
+		d.X = &v
+	}
+	if mask&fieldY != 0 {
+		v := r.quantized(positionScale)
+		d.Y = &v
+	}
+	if mask&fieldFlash != 0 {
+		v := mask&fieldFlashOn != 0
+		d.Flash = &v
+	}
+	if mask&fieldPing != 0 {
+		v := int(r.uvarint())
+		d.Ping = &v
+	}
+	if mask&fieldEffects != 0 {
+		v := r.effects()
+		if v == nil {
+			v = []services.EffectSnapshot{}
+		}
+		d.Effects = &v
+	}
+	if mask&fieldFacing != 0 {
+		v := r.quantized(angleScale)
+		d.Facing = &v
+	}
+	return d
+}
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) MarshalClient(m ClientMessage) ([]byte, error) {
+	return marshalJSONLine(m)
+}
+
+func (jsonCodec) MarshalServer(m ServerMessage) ([]byte, error) {
+	return marshalJSONLine(m)
+}
+
+func (jsonCodec) NewDecoder(r io.Reader) Decoder {
+	cr := &cappedReader{r: r, limit: MaxFrameSize}
+	return &jsonDecoder{r: cr, dec: json.NewDecoder(cr)}
+}
+
+func marshalJSONLine(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	return append(b, '\n'), nil
+}
+
+type jsonDecoder struct {
+	r   *cappedReader
+	dec *json.Decoder
+}
+
+func (d *jsonDecoder) DecodeClient(m *ClientMessage) error {
+	return d.decode(m)
+}
+
+func (d *jsonDecoder) DecodeServer(m *ServerMessage) error {
+	return d.decode(m)
+}
+
+func (d *jsonDecoder) setFrameLimit(n int) {
+	d.r.limit = n
+}
+
+func (d *jsonDecoder) decode(v interface{}) error {
+	d.r.n = 0
+	return d.dec.Decode(v)
+}
+
+// cappedReader fails once more than limit bytes are read without a reset.
+// json.Decoder reads ahead, so the cap is approximate but bounded.
+type cappedReader struct {
+	r     io.Reader
+	n     int
+	limit int
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.n >= c.limit {
+		return 0, ErrFrameTooLarge
+	}
+	if len(p) > c.limit-c.n {
+		p = p[:c.limit-c.n]
+	}
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,177 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"net"
+	"sync"
+)
+
+// CompressionDeflate compresses everything after the handshake as a single
+// flate stream per direction, flushed after every message. The stream's
+// window carries over between messages, so keys, classes and ids repeated
+// from one snapshot to the next cost only a back-reference.
+const CompressionDeflate = "deflate"
+
+// deflateDictionary primes both streams with JSON typical of the protocol
+// so even the first messages compress well.
+var deflateDictionary = buildDeflateDictionary()
+
+func buildDeflateDictionary() []byte {
+	health, x := 100.0, 400.0
+	state := "running"
+	characters := []services.CharacterSnapshot{
+		{ID: "player-0001", Class: "warrior", State: "idle", Health: 100, X: 400, Y: 400, Ping: 20},
+		{ID: "player-0002", Class: "mage", State: "attacking", Health: 80, X: 400, Y: 400, Flash: true},
+	}
+	samples := []interface{}{
+		ClientMessage{Kind: ClientCommand, Command: &command.DTO{Type: command.MOVE, RequestID: 1, CharacterID: "player-0001", Data: map[string]interface{}{"dx": 2, "dy": 2}}},
+		ClientMessage{Kind: ClientAck, Ack: 1},
+		ServerMessage{Kind: ServerEvent, Event: &services.GameEvent{Type: services.EventAttacked, Actor: "player-0001", Target: "player-0002", Amount: 10}},
+		ServerMessage{Kind: ServerSnapshot, Snapshot: &SnapshotMessage{Seq: 1, Full: &services.WorldSnapshot{Characters: characters}}},
+		ServerMessage{Kind: ServerSnapshot, Snapshot: &SnapshotMessage{Seq: 2, Baseline: 1, Delta: &services.SnapshotDelta{
+			Changed: []services.CharacterDelta{{ID: "player-0001", State: &state, Health: &health, X: &x, Y: &x}},
+		}}},
+	}
+	var dict []byte
+	for _, m := range samples {
+		b, _ := json.Marshal(m)
+		dict = append(dict, b...)
+	}
+	return dict
+}
+
+// negotiateCompression picks the first compression the client offered that
+// the connection supports. Messages sent unreliably may be lost or reordered,
+// which a stream compressor cannot survive, so UDP is never compressed.
+func negotiateCompression(offered []string, enabled bool, c net.Conn) string {
+	if !enabled {
+		return ""
+	}
+	if _, ok := c.(unreliableWriter); ok {
+		return ""
+	}
+	for _, name := range offered {
+		if name == CompressionDeflate {
+			return name
+		}
+	}
+	return ""
+}
+
+// deflateConn compresses writes and decompresses reads. Each Write is sent
+// as one frame: a uvarint length and the deflate output flushed at a byte
+// boundary, minus the 00 00 ff ff tail every flush ends with, which the
+// reader puts back.
+type deflateConn struct {
+	net.Conn
+	in io.Reader
+
+	wmu  sync.Mutex
+	buf  bytes.Buffer
+	fw   *flate.Writer
+	wire *byteRate
+}
+
+var deflateTail = []byte{0, 0, 0xff, 0xff}
+
+// newDeflateConn reads compressed frames from r, which must start right
+// after the handshake (see afterWelcome). wire, if not nil, counts the
+// compressed bytes written.
+func newDeflateConn(c net.Conn, r io.Reader, wire *byteRate) *deflateConn {
+	dc := &deflateConn{Conn: c, wire: wire}
+	// Up to level 6 the compressor stores the short blocks that flushing
+	// every message produces instead of matching them against the window.
+	dc.fw, _ = flate.NewWriterDict(&dc.buf, flate.BestCompression, deflateDictionary)
+	dc.in = flate.NewReaderDict(&deflateFrames{r: bufio.NewReader(r)}, deflateDictionary)
+	return dc
+}
+
+func (c *deflateConn) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+func (c *deflateConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.buf.Reset()
+	if _, err := c.fw.Write(p); err != nil {
+		return 0, err
+	}
+	if err := c.fw.Flush(); err != nil {
+		return 0, err
+	}
+	body := bytes.TrimSuffix(c.buf.Bytes(), deflateTail)
+	frame := binary.AppendUvarint(make([]byte, 0, len(body)+binary.MaxVarintLen32), uint64(len(body)))
+	frame = append(frame, body...)
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	if c.wire != nil {
+		c.wire.add(len(frame))
+	}
+	return len(p), nil
+}
+
+// deflateFrames strips the length prefixes, restores the flush tails and
+// yields the deflate stream.
+type deflateFrames struct {
+	r         *bufio.Reader
+	remaining uint64
+	tail      []byte
+}
+
+func (f *deflateFrames) Read(p []byte) (int, error) {
+	if f.remaining == 0 && len(f.tail) > 0 {
+		n := copy(p, f.tail)
+		f.tail = f.tail[n:]
+		return n, nil
+	}
+	for f.remaining == 0 {
+		n, err := binary.ReadUvarint(f.r)
+		if err != nil {
+			return 0, err
+		}
+		if n > MaxFrameSize {
+			return 0, ErrFrameTooLarge
+		}
+		f.remaining, f.tail = n, deflateTail
+	}
+	if uint64(len(p)) > f.remaining {
+		p = p[:f.remaining]
+	}
+	n, err := f.r.Read(p)
+	f.remaining -= uint64(n)
+	return n, err
+}
+
+// afterWelcome is afterHandshake for compressed streams, which may start
+// with any byte: it drops exactly the newline ending the last JSON
+// handshake message.
+func afterWelcome(d *json.Decoder, r io.Reader) io.Reader {
+	return &newlineSkipper{r: io.MultiReader(d.Buffered(), r)}
+}
+
+type newlineSkipper struct {
+	r    io.Reader
+	done bool
+}
+
+func (s *newlineSkipper) Read(p []byte) (int, error) {
+	if !s.done && len(p) > 0 {
+		s.done = true
+		if _, err := io.ReadFull(s.r, p[:1]); err != nil {
+			return 0, err
+		}
+		if p[0] != '\n' {
+			return 1, nil
+		}
+	}
+	return s.r.Read(p)
+}
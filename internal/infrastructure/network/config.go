@@ -0,0 +1,138 @@
+package network
+
+import (
+	"meatgrinder/internal/application/command"
+	"time"
+)
+
+type ServerConfig struct {
+	Addr string
+	// SendQueueSize bounds the per-connection queue of reliable messages.
+	// A peer that overflows it is evicted.
+	SendQueueSize int
+	// WriteTimeout is the deadline for a single write to a peer.
+	WriteTimeout time.Duration
+	// MaxCoalescedSnapshots is how many snapshots in a row may be replaced
+	// by a newer one before the peer is considered too slow and evicted.
+	MaxCoalescedSnapshots int
+	// ResumeGracePeriod is how long a disconnected player's character stays
+	// in the world waiting for the client to resume. Zero removes it at once.
+	ResumeGracePeriod time.Duration
+	// HeartbeatInterval is how often the server pings each peer.
+	HeartbeatInterval time.Duration
+	// IdleTimeout disconnects a peer that sent nothing, pongs included, for
+	// this long.
+	IdleTimeout time.Duration
+	// ShutdownTimeout bounds how long Serve waits for connections to drain
+	// after its context is cancelled.
+	ShutdownTimeout time.Duration
+	// WebSocketAddr, when set, makes ListenAndServeWebSocket accept
+	// WebSocket connections on WebSocketPath.
+	WebSocketAddr string
+	WebSocketPath string
+	// UDPAddr, when set, makes ListenAndServeUDP accept UDP clients. UDP
+	// is unavailable while TLS is configured.
+	UDPAddr string
+	// InterestRadius limits each player's snapshots to characters within
+	// this distance of their own, plus always-relevant ones. Zero sends
+	// everyone the whole world.
+	InterestRadius float64
+	// MaxMessageSize caps a single message from a client. A client sending
+	// a larger one is disconnected.
+	MaxMessageSize int
+	// MessageRate limits every message a connection sends, CommandRates
+	// each command type and ChatRate chat messages on top of that. Chat is
+	// fanned out to every player, so its burst stays well below
+	// SendQueueSize. Messages over a limit are dropped.
+	// After FloodWarnAfter drops within FloodWindow the player is warned,
+	// after FloodKickAfter disconnected. Zero disables a step.
+	MessageRate    RateLimit
+	CommandRates   map[command.Type]RateLimit
+	ChatRate       RateLimit
+	FloodWindow    time.Duration
+	FloodWarnAfter int
+	FloodKickAfter int
+	// TLSCertFile and TLSKeyFile are PEM files. When set, TCP and WebSocket
+	// clients must connect over TLS and UDP is not served.
+	TLSCertFile string
+	TLSKeyFile  string
+	// Compression lets clients negotiate a compressed stream.
+	Compression bool
+	// MaxPlayers caps the characters in the world, counting those waiting
+	// to be resumed. Once reached, new players wait in a join queue of up to
+	// JoinQueueSize, or watch as spectators if AdmitSpectators is set.
+	// MaxConnsPerIP limits connections from one address. Zero means no
+	// limit.
+	MaxPlayers      int
+	JoinQueueSize   int
+	AdmitSpectators bool
+	MaxConnsPerIP   int
+}
+
+func DefaultServerConfig(addr string) ServerConfig {
+	return ServerConfig{
+		Addr:                  addr,
+		SendQueueSize:         64,
+		WriteTimeout:          2 * time.Second,
+		MaxCoalescedSnapshots: 25,
+		ResumeGracePeriod:     30 * time.Second,
+		HeartbeatInterval:     time.Second,
+		IdleTimeout:           10 * time.Second,
+		ShutdownTimeout:       5 * time.Second,
+		WebSocketPath:         "/ws",
+		MaxMessageSize:        4 << 10,
+		MessageRate:           RateLimit{Rate: 200, Burst: 100},
+		// The client sends a MOVE per pressed key per frame.
+		CommandRates: map[command.Type]RateLimit{
+			command.SPAWN:  {Rate: 1, Burst: 3},
+			command.MOVE:   {Rate: 120, Burst: 30},
+			command.ATTACK: {Rate: 10, Burst: 10},
+			command.CAST:   {Rate: 10, Burst: 10},
+		},
+		ChatRate:       RateLimit{Rate: 2, Burst: 5},
+		FloodWindow:    10 * time.Second,
+		FloodWarnAfter: 50,
+		FloodKickAfter: 500,
+		JoinQueueSize:  32,
+		Compression:    true,
+	}
+}
+
+type ClientConfig struct {
+	// Addr is host:port for TCP, tls://host:port for TCP over TLS, a ws://
+	// or wss:// URL for WebSocket or udp://host:port for UDP.
+	Addr string
+	// CharacterID is requested during the handshake. Empty lets the server
+	// assign one.
+	CharacterID string
+	// Codecs are offered to the server in order of preference, and so are
+	// Compression methods.
+	Codecs      []string
+	Compression []string
+	// Reconnect makes the client redial after the connection drops, waiting
+	// between ReconnectMinBackoff and ReconnectMaxBackoff between attempts.
+	Reconnect           bool
+	ReconnectMinBackoff time.Duration
+	ReconnectMaxBackoff time.Duration
+	// HeartbeatInterval and IdleTimeout mirror the server settings so a
+	// client notices a dead server instead of waiting forever.
+	HeartbeatInterval time.Duration
+	IdleTimeout       time.Duration
+	// TLSPinnedCert is the path of a PEM certificate, typically self-signed,
+	// that a TLS server must present. Without it the server is verified
+	// against the system roots.
+	TLSPinnedCert string
+}
+
+func DefaultClientConfig(addr string) ClientConfig {
+	return ClientConfig{
+		Addr:                addr,
+		Codecs:              []string{BinaryCodec.Name(), JSONCodec.Name()},
+		Compression:         []string{CompressionDeflate},
+		Reconnect:           true,
+		ReconnectMinBackoff: 100 * time.Millisecond,
+		ReconnectMaxBackoff: 5 * time.Second,
+		HeartbeatInterval:   time.Second,
+		IdleTimeout:         10 * time.Second,
+	}
+}
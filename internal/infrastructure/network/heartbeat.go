@@ -0,0 +1,56 @@
+package network
+
+import (
+	"meatgrinder/internal/application/services"
+	"sync"
+	"time"
+)
+
+// rttGain is the weight of a new sample in the smoothed estimates, the same
+// 1/8 TCP uses for SRTT.
+const rttGain = 8
+
+// clockEstimator turns pongs into a smoothed round-trip time and an
+// estimate of the remote clock's offset from ours.
+type clockEstimator struct {
+	mu      sync.Mutex
+	sampled bool
+	latency services.Latency
+}
+
+// observe records the pong h received at now, all times in Unix
+// nanoseconds. The remote side is assumed to have answered halfway through
+// the round trip. Samples that would give a negative RTT are ignored.
+func (e *clockEstimator) observe(h Heartbeat, now int64) (services.Latency, bool) {
+	rtt := time.Duration(now - h.SentAt)
+	if rtt < 0 {
+		return services.Latency{}, false
+	}
+	offset := time.Duration(h.ReplyAt - (h.SentAt + int64(rtt/2)))
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.sampled {
+		e.latency = services.Latency{RTT: rtt, ClockOffset: offset}
+		e.sampled = true
+	} else {
+		e.latency.RTT += (rtt - e.latency.RTT) / rttGain
+		e.latency.ClockOffset += (offset - e.latency.ClockOffset) / rttGain
+	}
+	return e.latency, true
+}
+
+func (e *clockEstimator) current() services.Latency {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.latency
+}
+
+func newPing() *Heartbeat {
+	return &Heartbeat{SentAt: time.Now().UnixNano()}
+}
+
+// pong answers ping with our current clock.
+func pong(ping Heartbeat) *Heartbeat {
+	return &Heartbeat{SentAt: ping.SentAt, ReplyAt: time.Now().UnixNano()}
+}
@@ -0,0 +1,230 @@
+package network
+
+import (
+	"log"
+	"meatgrinder/internal/application/services"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const snapshotHistorySize = 32
+
+// peer owns the outbound side of one connection. Reliable messages go
+// through a bounded queue; snapshots are coalesced so only the latest one
+// waits to be written.
+type peer struct {
+	id           string
+	conn         net.Conn
+	codec        Codec
+	writeTimeout time.Duration
+	heartbeat    time.Duration
+	maxCoalesced int32
+	interest     services.Interest
+	metrics      *serverMetrics
+
+	out       chan []byte
+	snapshot  chan []byte
+	coalesced atomic.Int32
+	done      chan struct{}
+	closeOnce sync.Once
+	draining  chan struct{}
+	drainOnce sync.Once
+
+	// acked is written by the connection reader, history is only touched
+	// by the server's broadcast goroutine.
+	acked   atomic.Uint64
+	history map[uint64]services.WorldSnapshot
+
+	clock clockEstimator
+}
+
+func newPeer(id string, conn net.Conn, codec Codec, cfg ServerConfig, m *serverMetrics) *peer {
+	return &peer{
+		id:           id,
+		conn:         conn,
+		codec:        codec,
+		writeTimeout: cfg.WriteTimeout,
+		heartbeat:    cfg.HeartbeatInterval,
+		maxCoalesced: int32(cfg.MaxCoalescedSnapshots),
+		interest:     services.Interest{Radius: cfg.InterestRadius},
+		metrics:      m,
+		out:          make(chan []byte, cfg.SendQueueSize),
+		snapshot:     make(chan []byte, 1),
+		done:         make(chan struct{}),
+		draining:     make(chan struct{}),
+		history:      make(map[uint64]services.WorldSnapshot),
+	}
+}
+
+// snapshotMessage encodes the part of ss within the peer's area of interest
+// as a delta against the newest view the client acknowledged, or as a full
+// snapshot when that baseline is unknown. The view is stamped with the last
+// input the server processed for the peer's own character and with that
+// character's cooldowns and energy.
+func (p *peer) snapshotMessage(seq uint64, ss services.WorldSnapshot) SnapshotMessage {
+	msg := SnapshotMessage{Seq: seq}
+	view := p.interest.View(ss, p.id)
+	for _, c := range ss.Characters {
+		if c.ID == p.id {
+			view.LastInputSeq = c.InputSeq
+			view.Abilities, view.Energy = c.Abilities, c.Energy
+			break
+		}
+	}
+	ack := p.acked.Load()
+	if base, ok := p.history[ack]; ok {
+		d := services.DiffViews(base, view, ss)
+		msg.Baseline = ack
+		msg.Delta = &d
+	} else {
+		msg.Full = &view
+	}
+
+	p.history[seq] = view
+	if seq > snapshotHistorySize {
+		delete(p.history, seq-snapshotHistorySize)
+	}
+	return msg
+}
+
+func (p *peer) sendMessage(m ServerMessage) {
+	b, err := p.codec.MarshalServer(m)
+	if err != nil {
+		log.Printf("encode %s message for %s: %v", m.Kind, p.id, err)
+		return
+	}
+	p.send(b)
+}
+
+// sendResult answers a command that carried a request ID.
+func (p *peer) sendResult(requestID uint64, err error) {
+	r := CommandResult{RequestID: requestID}
+	if err != nil {
+		r.Code = string(services.ErrorCodeOf(err))
+		r.Message = err.Error()
+	}
+	p.sendMessage(ServerMessage{Kind: ServerResult, Result: &r})
+}
+
+func (p *peer) send(b []byte) {
+	select {
+	case p.out <- b:
+	case <-p.done:
+	default:
+		p.metrics.messagesDropped.Add(1)
+		p.evict("send queue overflow")
+	}
+}
+
+func (p *peer) sendSnapshot(b []byte) {
+	select {
+	case <-p.done:
+		return
+	default:
+	}
+	for {
+		select {
+		case p.snapshot <- b:
+			return
+		default:
+		}
+		select {
+		case <-p.snapshot:
+			p.metrics.snapshotsCoalesced.Add(1)
+			if p.coalesced.Add(1) > p.maxCoalesced {
+				p.evict("too many coalesced snapshots")
+				return
+			}
+		default:
+		}
+	}
+}
+
+func (p *peer) writeLoop() {
+	defer p.close()
+	var pings <-chan time.Time
+	if p.heartbeat > 0 {
+		t := time.NewTicker(p.heartbeat)
+		defer t.Stop()
+		pings = t.C
+	}
+	for {
+		var b []byte
+		// Snapshots and pings are superseded by the next one, so they may
+		// travel on a transport's unreliable lane.
+		unreliable := false
+		select {
+		case <-p.done:
+			return
+		case b = <-p.out:
+		case b = <-p.snapshot:
+			p.coalesced.Store(0)
+			unreliable = true
+		case <-p.draining:
+			p.flush()
+			return
+		case <-pings:
+			var err error
+			if b, err = p.codec.MarshalServer(ServerMessage{Kind: ServerPing, Heartbeat: newPing()}); err != nil {
+				continue
+			}
+			unreliable = true
+		}
+		_ = p.conn.SetWriteDeadline(time.Now().Add(p.writeTimeout))
+		if err := writeMessage(p.conn, b, unreliable); err != nil {
+			p.metrics.writeErrors.Add(1)
+			return
+		}
+		p.countSent(b)
+	}
+}
+
+// drain makes the writer send whatever reliable messages are queued and
+// then close the connection.
+func (p *peer) drain() {
+	p.drainOnce.Do(func() { close(p.draining) })
+}
+
+func (p *peer) flush() {
+	for {
+		select {
+		case b := <-p.out:
+			_ = p.conn.SetWriteDeadline(time.Now().Add(p.writeTimeout))
+			if _, err := p.conn.Write(b); err != nil {
+				p.metrics.writeErrors.Add(1)
+				return
+			}
+			p.countSent(b)
+		default:
+			return
+		}
+	}
+}
+
+// countSent records a message written to the peer. A compressed connection
+// counts its compressed bytes itself.
+func (p *peer) countSent(b []byte) {
+	p.metrics.rawBytes.add(len(b))
+	if _, compressed := p.conn.(*deflateConn); !compressed {
+		p.metrics.compressedBytes.add(len(b))
+	}
+}
+
+func (p *peer) evict(reason string) {
+	p.closeOnce.Do(func() {
+		p.metrics.slowConsumersEvicted.Add(1)
+		log.Printf("evicting %s: %s", p.id, reason)
+		p.shutdown()
+	})
+}
+
+func (p *peer) close() {
+	p.closeOnce.Do(p.shutdown)
+}
+
+func (p *peer) shutdown() {
+	close(p.done)
+	_ = p.conn.Close()
+}
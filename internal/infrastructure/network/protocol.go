@@ -0,0 +1,205 @@
+package network
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const ProtocolVersion = 11
+
+// Hello is the first message a client sends. CharacterID is optional: when
+// empty the server assigns one. Codecs lists the codecs the client can speak
+// in order of preference, Compression the stream compressions it supports.
+// A ResumeToken from an earlier Welcome reclaims
+// that session's character instead of joining as a new player.
+type Hello struct {
+	Version     int      `json:"version"`
+	CharacterID string   `json:"character_id,omitempty"`
+	Codecs      []string `json:"codecs,omitempty"`
+	ResumeToken string   `json:"resume_token,omitempty"`
+	Compression []string `json:"compression,omitempty"`
+}
+
+// Welcome answers a Hello. A non-empty Error means the connection was
+// rejected and will be closed by the server. Everything after the Welcome is
+// encoded with Codec and, if set, compressed with Compression. ResumeToken
+// changes on every Welcome.
+//
+// When the server is full the client is put in the join queue and first
+// receives Welcomes with only QueuePosition set, repeated as it moves up
+// and periodically while it waits. A Spectator may watch but has no
+// character.
+type Welcome struct {
+	Version       int    `json:"version"`
+	CharacterID   string `json:"character_id,omitempty"`
+	Codec         string `json:"codec,omitempty"`
+	Compression   string `json:"compression,omitempty"`
+	ResumeToken   string `json:"resume_token,omitempty"`
+	Resumed       bool   `json:"resumed,omitempty"`
+	QueuePosition int    `json:"queue_position,omitempty"`
+	Spectator     bool   `json:"spectator,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+type ClientMessageKind string
+
+const (
+	ClientCommand ClientMessageKind = "command"
+	// ClientAck reports the last snapshot sequence the client has applied.
+	// An Ack of 0 asks the server for a full snapshot.
+	ClientAck  ClientMessageKind = "ack"
+	ClientChat ClientMessageKind = "chat"
+	ClientPing ClientMessageKind = "ping"
+	ClientPong ClientMessageKind = "pong"
+)
+
+const maxChatLength = 256
+
+// chatText trims s, drops invalid UTF-8 and cuts it to maxChatLength bytes
+// without splitting a rune.
+func chatText(s string) string {
+	s = strings.ToValidUTF8(strings.TrimSpace(s), "")
+	if len(s) > maxChatLength {
+		n := maxChatLength
+		for n > 0 && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		s = s[:n]
+	}
+	return s
+}
+
+// ClientMessage is what a client sends after the handshake.
+type ClientMessage struct {
+	Kind      ClientMessageKind `json:"kind"`
+	Command   *command.DTO      `json:"command,omitempty"`
+	Ack       uint64            `json:"ack,omitempty"`
+	Text      string            `json:"text,omitempty"`
+	Heartbeat *Heartbeat        `json:"heartbeat,omitempty"`
+}
+
+type ServerMessageKind string
+
+const (
+	ServerSnapshot ServerMessageKind = "snapshot"
+	ServerEvent    ServerMessageKind = "event"
+	ServerResult   ServerMessageKind = "result"
+	ServerChat     ServerMessageKind = "chat"
+	ServerNotice   ServerMessageKind = "notice"
+	ServerPing     ServerMessageKind = "ping"
+	ServerPong     ServerMessageKind = "pong"
+)
+
+// ServerMessage is what the server sends after the handshake. Exactly one
+// payload, matching Kind, is set.
+type ServerMessage struct {
+	Kind      ServerMessageKind   `json:"kind"`
+	Snapshot  *SnapshotMessage    `json:"snapshot,omitempty"`
+	Event     *services.GameEvent `json:"event,omitempty"`
+	Result    *CommandResult      `json:"result,omitempty"`
+	Chat      *ChatMessage        `json:"chat,omitempty"`
+	Notice    *Notice             `json:"notice,omitempty"`
+	Heartbeat *Heartbeat          `json:"heartbeat,omitempty"`
+}
+
+// CommandResult reports the outcome of a command back to its sender. An
+// empty Code means the command succeeded; otherwise it is one of the
+// services.ErrorCode values.
+type CommandResult struct {
+	RequestID uint64 `json:"request_id"`
+	Code      string `json:"code,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+func (r CommandResult) OK() bool {
+	return r.Code == ""
+}
+
+// Heartbeat is sent by either side as a ping and echoed back as a pong.
+// SentAt is the pinging side's clock and ReplyAt the answering side's clock
+// when it replied, both in Unix nanoseconds. ReplyAt is zero in a ping.
+type Heartbeat struct {
+	SentAt  int64 `json:"sent_at"`
+	ReplyAt int64 `json:"reply_at,omitempty"`
+}
+
+type ChatMessage struct {
+	From string `json:"from"`
+	Text string `json:"text"`
+}
+
+type NoticeLevel string
+
+const (
+	NoticeInfo    NoticeLevel = "info"
+	NoticeWarning NoticeLevel = "warning"
+	// NoticeShutdown is the last message before the server closes the
+	// connection; Text holds the reason.
+	NoticeShutdown NoticeLevel = "shutdown"
+	// NoticeKick is sent before the server drops a misbehaving client.
+	NoticeKick NoticeLevel = "kick"
+)
+
+type Notice struct {
+	Level NoticeLevel `json:"level"`
+	Text  string      `json:"text"`
+}
+
+// SnapshotMessage carries either a full snapshot or a delta against the
+// snapshot numbered Baseline, which the client has previously acknowledged.
+type SnapshotMessage struct {
+	Seq      uint64                  `json:"seq"`
+	Baseline uint64                  `json:"baseline,omitempty"`
+	Full     *services.WorldSnapshot `json:"full,omitempty"`
+	Delta    *services.SnapshotDelta `json:"delta,omitempty"`
+}
+
+var ErrHandshakeRejected = errors.New("handshake rejected")
+
+var characterIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+func validateCharacterID(id string) error {
+	if !characterIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid character id %q", id)
+	}
+	return nil
+}
+
+// afterHandshake returns a reader for the rest of the stream. The JSON
+// decoder used for the handshake may already hold bytes past the Hello or
+// Welcome, and the newline the encoder wrote after it may or may not have
+// been consumed yet. Binary frames never start with whitespace because their
+// length prefix begins with a zero byte, so leading whitespace is dropped.
+func afterHandshake(d *json.Decoder, r io.Reader) io.Reader {
+	return &spaceSkipper{r: io.MultiReader(d.Buffered(), r)}
+}
+
+type spaceSkipper struct {
+	r    io.Reader
+	done bool
+}
+
+func (s *spaceSkipper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		if s.done {
+			return n, err
+		}
+		trimmed := bytes.TrimLeft(p[:n], " \t\r\n")
+		if len(trimmed) > 0 {
+			s.done = true
+			return copy(p, trimmed), err
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
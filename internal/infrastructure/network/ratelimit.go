@@ -0,0 +1,118 @@
+package network
+
+import (
+	"meatgrinder/internal/application/command"
+	"time"
+)
+
+// RateLimit is a token bucket refilled at Rate tokens per second and holding
+// at most Burst. A zero Rate means no limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type tokenBucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(l RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{limit: l, tokens: float64(l.Burst), last: now}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	if b.limit.Rate <= 0 {
+		return true
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type floodVerdict int
+
+const (
+	floodAllow floodVerdict = iota
+	floodDrop
+	// floodWarn drops the message and tells the player to slow down.
+	floodWarn
+	floodKick
+)
+
+// floodGuard enforces a connection's rate limits. Messages over a limit are
+// dropped; the penalty escalates with the number of drops in the current
+// window. It is only used by the connection's reader.
+type floodGuard struct {
+	messages *tokenBucket
+	commands map[command.Type]*tokenBucket
+	chat     *tokenBucket
+	metrics  *serverMetrics
+
+	window      time.Duration
+	warnAfter   int
+	kickAfter   int
+	windowStart time.Time
+	violations  int
+	warned      bool
+}
+
+func newFloodGuard(cfg ServerConfig, m *serverMetrics, now time.Time) *floodGuard {
+	g := &floodGuard{
+		messages:    newTokenBucket(cfg.MessageRate, now),
+		commands:    make(map[command.Type]*tokenBucket, len(cfg.CommandRates)),
+		chat:        newTokenBucket(cfg.ChatRate, now),
+		metrics:     m,
+		window:      cfg.FloodWindow,
+		warnAfter:   cfg.FloodWarnAfter,
+		kickAfter:   cfg.FloodKickAfter,
+		windowStart: now,
+	}
+	for t, l := range cfg.CommandRates {
+		g.commands[t] = newTokenBucket(l, now)
+	}
+	return g
+}
+
+func (g *floodGuard) check(m ClientMessage, now time.Time) floodVerdict {
+	if !g.messages.allow(now) {
+		g.metrics.messagesRateLimited.Add(1)
+		return g.violation(now)
+	}
+	if m.Kind == ClientCommand && m.Command != nil {
+		if b, ok := g.commands[m.Command.Type]; ok && !b.allow(now) {
+			g.metrics.commandsRateLimited.Add(1)
+			return g.violation(now)
+		}
+	}
+	if m.Kind == ClientChat && !g.chat.allow(now) {
+		g.metrics.chatRateLimited.Add(1)
+		return g.violation(now)
+	}
+	return floodAllow
+}
+
+func (g *floodGuard) violation(now time.Time) floodVerdict {
+	if g.window > 0 && now.Sub(g.windowStart) > g.window {
+		g.windowStart, g.violations, g.warned = now, 0, false
+	}
+	g.violations++
+	switch {
+	case g.kickAfter > 0 && g.violations >= g.kickAfter:
+		g.metrics.floodKicks.Add(1)
+		return floodKick
+	case !g.warned && g.warnAfter > 0 && g.violations >= g.warnAfter:
+		g.warned = true
+		g.metrics.floodWarnings.Add(1)
+		return floodWarn
+	}
+	return floodDrop
+}
@@ -3,100 +3,419 @@ package network
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"meatgrinder/internal/application/command"
 	"meatgrinder/internal/application/services"
 	"net"
+	"os"
 	"sync"
 	"time"
 )
 
+const handshakeTimeout = 5 * time.Second
+
 type Server struct {
-	addr  string
-	game  *services.GameService
-	mu    sync.Mutex
-	conns map[net.Conn]struct{}
+	cfg       ServerConfig
+	game      *services.GameService
+	metrics   serverMetrics
+	mu        sync.Mutex
+	sessions  map[string]*session
+	tokens    map[string]*session
+	nextID    int
+	snapshots chan services.WorldSnapshot
+	seq       uint64
+
+	// spectators are keyed by their generated id, hosts counts connections
+	// per remote address and queue holds players waiting for a free slot.
+	spectators map[string]*session
+	hosts      map[string]int
+	queue      []*waiter
+
+	broadcastOnce  sync.Once
+	listeners      map[net.Listener]struct{}
+	conns          map[net.Conn]struct{}
+	handlers       sync.WaitGroup
+	closing        bool
+	shutdownReason string
+	shutdownOnce   sync.Once
+	shutdownErr    error
 }
 
-func NewServer(a string, g *services.GameService) *Server {
+func NewServer(cfg ServerConfig, g *services.GameService) *Server {
 	return &Server{
-		addr:  a,
-		game:  g,
-		conns: make(map[net.Conn]struct{}),
+		cfg:        cfg,
+		game:       g,
+		sessions:   make(map[string]*session),
+		tokens:     make(map[string]*session),
+		spectators: make(map[string]*session),
+		hosts:      make(map[string]int),
+		snapshots:  make(chan services.WorldSnapshot, 1),
+		listeners:  make(map[net.Listener]struct{}),
+		conns:      make(map[net.Conn]struct{}),
 	}
 }
 
 func (s *Server) ListenAndServe(ctx context.Context) error {
-	ln, err := net.Listen("tcp", s.addr)
+	ln, err := net.Listen("tcp", s.cfg.Addr)
 	if err != nil {
 		return err
 	}
 	defer ln.Close()
-	log.Printf("Server on %s", s.addr)
-	go s.broadcast(ctx)
+	log.Printf("Server on %s", s.cfg.Addr)
+	return s.Serve(ctx, ln)
+}
+
+func (s *Server) Stats() ServerStats {
+	return s.metrics.snapshot()
+}
+
+// Serve accepts connections on ln until ctx is cancelled, then shuts the
+// server down, waiting at most ShutdownTimeout for connections to drain.
+// Connections are TLS when a certificate is configured.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	ln, err := s.tlsListener(ln)
+	if err != nil {
+		return err
+	}
+	return s.serve(ctx, ln)
+}
+
+func (s *Server) serve(ctx context.Context, ln net.Listener) error {
+	if !s.addListener(ln) {
+		return ErrServerClosed
+	}
+	defer s.removeListener(ln)
+
+	stop := context.AfterFunc(ctx, func() { _ = ln.Close() })
+	defer stop()
+
+	s.startBroadcast(ctx)
 	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-		}
 		conn, err := ln.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				return s.shutdownAfterCancel()
+			}
+			if errors.Is(err, net.ErrClosed) {
+				if s.shuttingDown() {
+					return ErrServerClosed
+				}
+				return err
+			}
+			continue
+		}
+		if !s.track(conn) {
+			_ = conn.Close()
 			continue
 		}
-		s.mu.Lock()
-		s.conns[conn] = struct{}{}
-		s.mu.Unlock()
 		go s.handle(conn)
 	}
 }
 
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+func (s *Server) PublishEvents(events []services.GameEvent) {
+	for i := range events {
+		s.broadcastMessage(ServerMessage{Kind: ServerEvent, Event: &events[i]})
+	}
+}
+
+// Notify sends a notice to every connected player.
+func (s *Server) Notify(level NoticeLevel, text string) {
+	s.broadcastMessage(ServerMessage{Kind: ServerNotice, Notice: &Notice{Level: level, Text: text}})
+}
+
+// broadcastMessage queues m as a reliable message for every peer, encoding it
+// once per codec in use.
+func (s *Server) broadcastMessage(m ServerMessage) {
+	encoded := make(map[Codec][]byte, len(codecs))
+	for _, p := range s.peerList() {
+		b, ok := encoded[p.codec]
+		if !ok {
+			var err error
+			if b, err = p.codec.MarshalServer(m); err != nil {
+				log.Printf("encode %s message: %v", m.Kind, err)
+				return
+			}
+			encoded[p.codec] = b
+		}
+		p.send(b)
+	}
+}
+
+// PublishSnapshot is called from the game loop. It never blocks: if the
+// previous snapshot has not been sent yet it is replaced by the newer one.
+func (s *Server) PublishSnapshot(ss services.WorldSnapshot) {
+	for {
+		select {
+		case s.snapshots <- ss:
+			return
+		default:
+		}
+		select {
+		case <-s.snapshots:
+		default:
+		}
+	}
+}
+
 func (s *Server) handle(c net.Conn) {
-	d := json.NewDecoder(c)
-	charId := ""
+	defer s.untrack(c)
+	defer c.Close()
 
-	defer func() {
-		s.mu.Lock()
-		delete(s.conns, c)
-		s.mu.Unlock()
+	host := remoteHost(c)
+	s.addHost(host)
+	defer s.removeHost(host)
 
-		_ = s.game.ProcessCommandDTO(command.DTO{
-			Type:        command.DISCONNECT,
-			CharacterID: charId,
-			Data:        nil,
-		})
+	hs := json.NewDecoder(c)
+	sess, codec, compression, err := s.handshake(c, hs, host)
+	if err != nil {
+		log.Printf("handshake with %s failed: %v", c.RemoteAddr(), err)
+		return
+	}
+	charId := sess.id
+
+	setFraming(c, codec, compression)
+	conn, in := c, afterHandshake(hs, c)
+	if compression != "" {
+		dc := newDeflateConn(c, afterWelcome(hs, c), &s.metrics.compressedBytes)
+		conn, in = dc, dc
+	}
+	p := newPeer(charId, conn, codec, s.cfg, &s.metrics)
+	s.attachSession(sess, p)
+	go p.writeLoop()
 
-		_ = c.Close()
+	defer func() {
+		p.close()
+		s.detachSession(sess, p)
 	}()
 
+	d := codec.NewDecoder(in)
+	limitFrames(d, s.cfg.MaxMessageSize)
+	flood := newFloodGuard(s.cfg, &s.metrics, time.Now())
+	kicked := false
 	for {
-		var cmd command.DTO
-		if err := d.Decode(&cmd); err != nil {
+		if s.cfg.IdleTimeout > 0 {
+			_ = c.SetReadDeadline(time.Now().Add(s.cfg.IdleTimeout))
+		}
+		var m ClientMessage
+		if err := d.DecodeClient(&m); err != nil {
+			switch {
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				s.metrics.idleTimeouts.Add(1)
+				log.Printf("%s idle for %v, disconnecting", charId, s.cfg.IdleTimeout)
+			case errors.Is(err, ErrFrameTooLarge):
+				s.metrics.oversizedMessages.Add(1)
+				log.Printf("%s sent a message over %d bytes, disconnecting", charId, s.cfg.MaxMessageSize)
+			}
 			return
 		}
+		if kicked {
+			// Read until the writer has flushed the kick notice and closed
+			// the connection.
+			continue
+		}
+
+		switch flood.check(m, time.Now()) {
+		case floodDrop:
+			rejectFlooded(p, m)
+			continue
+		case floodWarn:
+			rejectFlooded(p, m)
+			p.sendMessage(ServerMessage{Kind: ServerNotice, Notice: &Notice{Level: NoticeWarning, Text: "you are sending too fast, slow down or you will be disconnected"}})
+			continue
+		case floodKick:
+			log.Printf("%s is flooding, disconnecting", charId)
+			s.markQuit(charId)
+			p.sendMessage(ServerMessage{Kind: ServerNotice, Notice: &Notice{Level: NoticeKick, Text: "disconnected for flooding"}})
+			p.drain()
+			kicked = true
+			continue
+		}
+
+		switch m.Kind {
+		case ClientAck:
+			p.acked.Store(m.Ack)
+		case ClientChat:
+			text := chatText(m.Text)
+			if text == "" {
+				continue
+			}
+			s.broadcastMessage(ServerMessage{Kind: ServerChat, Chat: &ChatMessage{From: charId, Text: text}})
+		case ClientCommand:
+			if m.Command == nil {
+				continue
+			}
+			if sess.spectator {
+				if m.Command.RequestID != 0 {
+					p.sendResult(m.Command.RequestID, &services.CommandError{Code: services.CodeForbidden, Message: "spectators cannot play"})
+				}
+				continue
+			}
+			s.enqueueCommand(p, *m.Command)
+		case ClientPing:
+			if m.Heartbeat != nil {
+				p.sendMessage(ServerMessage{Kind: ServerPong, Heartbeat: pong(*m.Heartbeat)})
+			}
+		case ClientPong:
+			if m.Heartbeat == nil {
+				continue
+			}
+			if l, ok := p.clock.observe(*m.Heartbeat, time.Now().UnixNano()); ok && !sess.spectator {
+				s.game.SetLatency(charId, l)
+			}
+		}
+	}
+}
+
+// rejectFlooded answers a rate limited command that asked for a result.
+func rejectFlooded(p *peer, m ClientMessage) {
+	if m.Kind == ClientCommand && m.Command != nil && m.Command.RequestID != 0 {
+		p.sendResult(m.Command.RequestID, &services.CommandError{Code: services.CodeRateLimited, Message: "rate limit exceeded"})
+	}
+}
+
+// enqueueCommand hands a command from p to the game loop. Commands with a
+// request ID are answered with a result once processed or rejected.
+func (s *Server) enqueueCommand(p *peer, cmd command.DTO) {
+	var reply services.ReplyFunc
+	if cmd.RequestID != 0 {
+		id := cmd.RequestID
+		reply = func(err error) { p.sendResult(id, err) }
+	}
+
+	if cmd.CharacterID != "" && cmd.CharacterID != p.id {
+		log.Printf("%s sent a command for %q, ignoring", p.id, cmd.CharacterID)
+		if reply != nil {
+			reply(&services.CommandError{Code: services.CodeForbidden, Message: "cannot command another character"})
+		}
+		return
+	}
+	cmd.CharacterID = p.id
+	if cmd.Type == command.DISCONNECT {
+		s.markQuit(p.id)
+	}
+	if err := s.game.Enqueue(cmd, reply); err != nil && reply != nil {
+		reply(err)
+	}
+}
+
+// handshake reads the client's Hello, negotiates a codec and binds a
+// session to the connection: a new one, the one named by the resume token
+// or, when the server is full, a spectator session or one obtained after
+// waiting in the join queue. The Welcome is written before the peer's
+// writer starts.
+func (s *Server) handshake(c net.Conn, d *json.Decoder, host string) (*session, Codec, string, error) {
+	_ = c.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer c.SetDeadline(time.Time{})
 
-		if charId == "" {
-			charId = cmd.CharacterID
+	var h Hello
+	if err := d.Decode(&h); err != nil {
+		return nil, nil, "", err
+	}
+
+	e := json.NewEncoder(c)
+	reject := func(reason error) (*session, Codec, string, error) {
+		_ = e.Encode(Welcome{Version: ProtocolVersion, Error: reason.Error()})
+		return nil, nil, "", reason
+	}
+
+	if h.Version != ProtocolVersion {
+		return reject(fmt.Errorf("unsupported protocol version %d, server speaks %d", h.Version, ProtocolVersion))
+	}
+	if h.CharacterID != "" {
+		if err := validateCharacterID(h.CharacterID); err != nil {
+			return reject(err)
 		}
-		_ = s.game.ProcessCommandDTO(cmd)
 	}
+	codec, ok := negotiateCodec(h.Codecs)
+	if !ok {
+		return reject(fmt.Errorf("none of the codecs %v are supported", h.Codecs))
+	}
+
+	compression := negotiateCompression(h.Compression, s.cfg.Compression, c)
+
+	resumed := h.ResumeToken != ""
+	s.mu.Lock()
+	var sess *session
+	var queued *waiter
+	var err error
+	switch {
+	case s.closing:
+		err = errors.New(errShuttingDown)
+	case s.cfg.MaxConnsPerIP > 0 && s.hosts[host] > s.cfg.MaxConnsPerIP:
+		err = errTooManyFromHost
+	case resumed:
+		sess, err = s.resumeSession(h.ResumeToken)
+	case !s.roomFull():
+		sess, err = s.reserveSession(h.CharacterID)
+	case s.cfg.AdmitSpectators:
+		sess = s.reserveSpectator()
+	case len(s.queue) < s.cfg.JoinQueueSize:
+		queued = s.enqueue(h.CharacterID)
+	default:
+		err = errServerFull
+	}
+	s.mu.Unlock()
+	if queued != nil {
+		_ = c.SetDeadline(time.Time{})
+		sess, err = s.waitForSlot(c, e, queued)
+		_ = c.SetWriteDeadline(time.Now().Add(handshakeTimeout))
+	}
+	if err != nil {
+		return reject(err)
+	}
+
+	w := Welcome{Version: ProtocolVersion, CharacterID: sess.id, Codec: codec.Name(), Compression: compression, ResumeToken: sess.token, Resumed: resumed}
+	if sess.spectator {
+		w = Welcome{Version: ProtocolVersion, Codec: codec.Name(), Compression: compression, Spectator: true}
+	}
+	if err := e.Encode(w); err != nil {
+		s.abandonSession(sess, resumed)
+		return nil, nil, "", err
+	}
+	return sess, codec, compression, nil
+}
+
+func (s *Server) startBroadcast(ctx context.Context) {
+	s.broadcastOnce.Do(func() { go s.broadcast(ctx) })
 }
 
 func (s *Server) broadcast(ctx context.Context) {
-	t := time.NewTicker(200 * time.Millisecond)
-	defer t.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-t.C:
-			ss := s.game.BuildWorldSnapshot()
-			b, _ := json.Marshal(ss)
-			s.mu.Lock()
-			for c := range s.conns {
-				c.Write(b)
+		case ss := <-s.snapshots:
+			s.seq++
+			for _, p := range s.peerList() {
+				msg := p.snapshotMessage(s.seq, ss)
+				b, err := p.codec.MarshalServer(ServerMessage{Kind: ServerSnapshot, Snapshot: &msg})
+				if err != nil {
+					continue
+				}
+				p.sendSnapshot(b)
+			}
+		}
+	}
+}
+
+func (s *Server) peerList() []*peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*peer, 0, len(s.sessions)+len(s.spectators))
+	for _, sessions := range []map[string]*session{s.sessions, s.spectators} {
+		for _, sess := range sessions {
+			if sess.state == sessionAttached {
+				list = append(list, sess.peer)
 			}
-			s.mu.Unlock()
 		}
 	}
+	return list
 }
@@ -0,0 +1,170 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errUnknownResumeToken = errors.New("unknown or expired resume token")
+
+type sessionState int
+
+const (
+	sessionPending sessionState = iota
+	sessionAttached
+	sessionDetached
+)
+
+// session outlives a single connection: when the connection drops the
+// character stays in the world for the grace period so a client presenting
+// the resume token can take it over again.
+type session struct {
+	id    string
+	token string
+	state sessionState
+	peer  *peer
+	// gen changes on every state transition so a stale expiry timer can
+	// tell it lost the race against a resume.
+	gen  uint64
+	quit bool
+	// spectator sessions watch without a character and cannot be resumed.
+	spectator bool
+}
+
+func newResumeToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// reserveSession creates a pending session for a new player. s.mu must be
+// held.
+func (s *Server) reserveSession(requested string) (*session, error) {
+	id := requested
+	if id == "" {
+		for {
+			s.nextID++
+			id = fmt.Sprintf("player-%04d", s.nextID)
+			if _, taken := s.sessions[id]; !taken {
+				break
+			}
+		}
+	} else if _, taken := s.sessions[id]; taken {
+		return nil, fmt.Errorf("character id %q is already in use", id)
+	}
+
+	sess := &session{id: id, token: newResumeToken()}
+	s.sessions[id] = sess
+	s.tokens[sess.token] = sess
+	return sess, nil
+}
+
+// resumeSession takes over the session owning token, closing its current
+// connection if the old one is still considered alive. The token is
+// rotated. s.mu must be held.
+func (s *Server) resumeSession(token string) (*session, error) {
+	sess, ok := s.tokens[token]
+	if !ok {
+		return nil, errUnknownResumeToken
+	}
+	if sess.peer != nil {
+		sess.peer.close()
+		sess.peer = nil
+	}
+	delete(s.tokens, sess.token)
+	sess.token = newResumeToken()
+	s.tokens[sess.token] = sess
+	sess.state = sessionPending
+	sess.gen++
+	return sess, nil
+}
+
+func (s *Server) attachSession(sess *session, p *peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.peer = p
+	sess.state = sessionAttached
+	sess.gen++
+	if s.closing {
+		// Shutdown began during the handshake and missed this peer.
+		p.sendMessage(ServerMessage{Kind: ServerNotice, Notice: &Notice{Level: NoticeShutdown, Text: s.shutdownReason}})
+		p.drain()
+	}
+}
+
+// detachSession is called when p's connection ends. Unless the player quit,
+// the character is kept for the grace period.
+func (s *Server) detachSession(sess *session, p *peer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess.peer != p || sess.state == sessionDetached {
+		return
+	}
+	if sess.spectator {
+		delete(s.spectators, sess.id)
+		return
+	}
+	s.startGracePeriod(sess)
+}
+
+// abandonSession undoes a reservation whose handshake failed. s.mu must not
+// be held.
+func (s *Server) abandonSession(sess *session, resumed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess.spectator {
+		delete(s.spectators, sess.id)
+		return
+	}
+	if resumed {
+		s.startGracePeriod(sess)
+		return
+	}
+	s.endSession(sess)
+}
+
+// startGracePeriod must be called with s.mu held.
+func (s *Server) startGracePeriod(sess *session) {
+	sess.peer = nil
+	sess.state = sessionDetached
+	sess.gen++
+	if sess.quit || s.cfg.ResumeGracePeriod <= 0 {
+		s.endSession(sess)
+		return
+	}
+	gen := sess.gen
+	time.AfterFunc(s.cfg.ResumeGracePeriod, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if sess.gen == gen {
+			s.endSession(sess)
+		}
+	})
+}
+
+// endSession forgets the session, removes its character and lets the next
+// queued player take the slot. s.mu must be held.
+func (s *Server) endSession(sess *session) {
+	if s.sessions[sess.id] != sess {
+		return
+	}
+	delete(s.sessions, sess.id)
+	delete(s.tokens, sess.token)
+	sess.gen++
+	s.game.ClearLatency(sess.id)
+	s.game.Disconnect(sess.id)
+	s.admitWaiting()
+}
+
+// markQuit records that the player left on purpose, so the session ends as
+// soon as the connection closes.
+func (s *Server) markQuit(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[id]; ok {
+		sess.quit = true
+	}
+}
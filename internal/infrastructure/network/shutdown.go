@@ -0,0 +1,97 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+)
+
+// ErrServerClosed is returned by Serve after Shutdown was called.
+var ErrServerClosed = errors.New("server closed")
+
+const errShuttingDown = "server is shutting down"
+
+// Shutdown stops accepting connections, tells every player why, flushes
+// what is already queued for them and waits for the connection handlers to
+// finish. If ctx ends first the remaining connections are closed and ctx's
+// error is returned. Later calls wait for the first one and return its
+// result.
+func (s *Server) Shutdown(ctx context.Context, reason string) error {
+	s.shutdownOnce.Do(func() {
+		s.mu.Lock()
+		s.closing = true
+		s.shutdownReason = reason
+		for ln := range s.listeners {
+			_ = ln.Close()
+		}
+		s.rejectWaiting(errShuttingDown)
+		s.mu.Unlock()
+
+		log.Printf("shutting down: %s", reason)
+		s.Notify(NoticeShutdown, reason)
+		for _, p := range s.peerList() {
+			p.drain()
+		}
+
+		done := make(chan struct{})
+		go func() {
+			s.handlers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.mu.Lock()
+			for c := range s.conns {
+				_ = c.Close()
+			}
+			s.mu.Unlock()
+			<-done
+			s.shutdownErr = ctx.Err()
+		}
+	})
+	return s.shutdownErr
+}
+
+func (s *Server) shutdownAfterCancel() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx, errShuttingDown)
+}
+
+func (s *Server) addListener(ln net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.listeners[ln] = struct{}{}
+	return true
+}
+
+func (s *Server) removeListener(ln net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, ln)
+}
+
+// track registers a freshly accepted connection, refusing it once shutdown
+// has begun.
+func (s *Server) track(c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.handlers.Add(1)
+	return true
+}
+
+func (s *Server) untrack(c net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	s.handlers.Done()
+}
@@ -0,0 +1,112 @@
+package network
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ServerStats struct {
+	SnapshotsCoalesced   uint64
+	MessagesDropped      uint64
+	SlowConsumersEvicted uint64
+	WriteErrors          uint64
+	IdleTimeouts         uint64
+	// MessagesRateLimited, CommandsRateLimited and ChatRateLimited count
+	// messages dropped by the per-connection, per-command and chat limits;
+	// FloodWarnings and FloodKicks the escalations that followed.
+	MessagesRateLimited uint64
+	CommandsRateLimited uint64
+	ChatRateLimited     uint64
+	FloodWarnings       uint64
+	FloodKicks          uint64
+	OversizedMessages   uint64
+	// RawBytes counts encoded messages written to clients, CompressedBytes
+	// what went out after compression; without compression the two are the
+	// same. The rates average the last few seconds.
+	RawBytes                 uint64
+	CompressedBytes          uint64
+	RawBytesPerSecond        float64
+	CompressedBytesPerSecond float64
+}
+
+type serverMetrics struct {
+	snapshotsCoalesced   atomic.Uint64
+	messagesDropped      atomic.Uint64
+	slowConsumersEvicted atomic.Uint64
+	writeErrors          atomic.Uint64
+	idleTimeouts         atomic.Uint64
+	messagesRateLimited  atomic.Uint64
+	commandsRateLimited  atomic.Uint64
+	chatRateLimited      atomic.Uint64
+	floodWarnings        atomic.Uint64
+	floodKicks           atomic.Uint64
+	oversizedMessages    atomic.Uint64
+	rawBytes             byteRate
+	compressedBytes      byteRate
+}
+
+func (m *serverMetrics) snapshot() ServerStats {
+	return ServerStats{
+		SnapshotsCoalesced:       m.snapshotsCoalesced.Load(),
+		MessagesDropped:          m.messagesDropped.Load(),
+		SlowConsumersEvicted:     m.slowConsumersEvicted.Load(),
+		WriteErrors:              m.writeErrors.Load(),
+		IdleTimeouts:             m.idleTimeouts.Load(),
+		MessagesRateLimited:      m.messagesRateLimited.Load(),
+		CommandsRateLimited:      m.commandsRateLimited.Load(),
+		ChatRateLimited:          m.chatRateLimited.Load(),
+		FloodWarnings:            m.floodWarnings.Load(),
+		FloodKicks:               m.floodKicks.Load(),
+		OversizedMessages:        m.oversizedMessages.Load(),
+		RawBytes:                 m.rawBytes.total(),
+		CompressedBytes:          m.compressedBytes.total(),
+		RawBytesPerSecond:        m.rawBytes.perSecond(time.Now()),
+		CompressedBytesPerSecond: m.compressedBytes.perSecond(time.Now()),
+	}
+}
+
+const rateWindow = 5
+
+// byteRate counts bytes in one-second buckets to report a recent rate as
+// well as the total.
+type byteRate struct {
+	mu      sync.Mutex
+	sum     uint64
+	buckets [rateWindow + 1]struct {
+		second int64
+		n      uint64
+	}
+}
+
+func (r *byteRate) add(n int) {
+	sec := time.Now().Unix()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sum += uint64(n)
+	b := &r.buckets[sec%int64(len(r.buckets))]
+	if b.second != sec {
+		b.second, b.n = sec, 0
+	}
+	b.n += uint64(n)
+}
+
+func (r *byteRate) total() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sum
+}
+
+// perSecond averages the last rateWindow complete seconds.
+func (r *byteRate) perSecond(now time.Time) float64 {
+	sec := now.Unix()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n uint64
+	for _, b := range r.buckets {
+		if b.second < sec && b.second >= sec-rateWindow {
+			n += b.n
+		}
+	}
+	return float64(n) / rateWindow
+}
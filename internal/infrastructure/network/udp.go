@@ -0,0 +1,716 @@
+package network
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// The UDP transport carries the same byte stream as TCP over two lanes.
+// Every Write is one message on the reliable lane: numbered, acknowledged,
+// retransmitted and delivered in order. WriteUnreliable sends a message
+// once; the receiver drops anything older than the newest it has seen, so
+// snapshots and movement input never wait behind a lost packet. Each
+// message must fit in a single datagram.
+//
+// Before a connection exists the client sends a padded udpHello and the
+// listener answers, without keeping any state, with a cookie: an HMAC of the
+// client's address and the time. The first reliable packet is sent as
+// udpOpen carrying that cookie, and only a valid cookie makes the listener
+// allocate a connection. A spoofed source address never receives its
+// cookie, and the padding keeps the answer smaller than the request, so the
+// listener cannot be used to flood a third party or fill the server with
+// fake players.
+
+const (
+	udpReliable byte = iota + 1
+	udpUnreliable
+	udpAck
+	udpClose
+	udpHello
+	udpCookie
+	udpOpen
+)
+
+const (
+	udpMaxDatagram        = 65000
+	udpWindow             = 512
+	udpInboxSize          = 1024
+	udpRetransmitTimeout  = 100 * time.Millisecond
+	udpRetransmitInterval = 20 * time.Millisecond
+	udpMaxRetransmits     = 50
+	udpLinger             = time.Second
+	// A cookie is an 8-byte issue time and a truncated HMAC.
+	udpCookieSize     = 8 + 16
+	udpHelloSize      = 64
+	udpCookieLifetime = 10 * time.Second
+)
+
+var (
+	errUDPWindowFull      = errors.New("udp send window full")
+	errUDPMessageTooLarge = errors.New("message does not fit in a datagram")
+	errUDPPeerUnreachable = errors.New("udp peer stopped acknowledging")
+)
+
+// unreliableWriter is implemented by transports that can send a message
+// without delivery guarantees.
+type unreliableWriter interface {
+	WriteUnreliable(b []byte) (int, error)
+}
+
+// writeMessage sends b on the unreliable lane when asked to and the
+// transport has one.
+func writeMessage(conn net.Conn, b []byte, unreliable bool) error {
+	if uw, ok := conn.(unreliableWriter); ok && unreliable {
+		_, err := uw.WriteUnreliable(b)
+		return err
+	}
+	_, err := conn.Write(b)
+	return err
+}
+
+type udpPending struct {
+	packet []byte
+	sentAt time.Time
+	tries  int
+}
+
+type udpConn struct {
+	pc      net.PacketConn
+	raddr   net.Addr
+	onClose func()
+	// cookie is sent with the first reliable packet by the dialing side.
+	cookie []byte
+
+	mu sync.Mutex
+	// Sending side.
+	nextSeq  uint64
+	nextUSeq uint64
+	pending  map[uint64]*udpPending
+	acked    chan struct{}
+	// Receiving side.
+	expected uint64
+	early    map[uint64][]byte
+	lastUSeq uint64
+	inbox    [][]byte
+	current  []byte
+	failure  error
+	eof      bool
+
+	notify chan struct{}
+	// closed ends reads and writes at once; done follows after the linger
+	// and stops retransmissions.
+	closed    chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	readDL    deadline
+}
+
+func newUDPConn(pc net.PacketConn, raddr net.Addr, onClose func()) *udpConn {
+	c := &udpConn{
+		pc:       pc,
+		raddr:    raddr,
+		onClose:  onClose,
+		nextSeq:  1,
+		nextUSeq: 1,
+		expected: 1,
+		pending:  make(map[uint64]*udpPending),
+		early:    make(map[uint64][]byte),
+		acked:    make(chan struct{}, 1),
+		notify:   make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+		readDL:   makeDeadline(),
+	}
+	go c.retransmitLoop()
+	return c
+}
+
+func (c *udpConn) Write(b []byte) (int, error) {
+	if len(b) > udpMaxDatagram {
+		return 0, errUDPMessageTooLarge
+	}
+	c.mu.Lock()
+	if err := c.writeErr(); err != nil {
+		c.mu.Unlock()
+		return 0, err
+	}
+	if len(c.pending) >= udpWindow {
+		c.mu.Unlock()
+		return 0, errUDPWindowFull
+	}
+	seq := c.nextSeq
+	c.nextSeq++
+	packet := []byte{udpReliable}
+	if seq == 1 && c.cookie != nil {
+		packet = append([]byte{udpOpen}, c.cookie...)
+	}
+	packet = binary.AppendUvarint(packet, seq)
+	packet = append(packet, b...)
+	c.pending[seq] = &udpPending{packet: packet, sentAt: time.Now()}
+	c.mu.Unlock()
+
+	if _, err := c.pc.WriteTo(packet, c.raddr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *udpConn) WriteUnreliable(b []byte) (int, error) {
+	if len(b) > udpMaxDatagram {
+		return 0, errUDPMessageTooLarge
+	}
+	c.mu.Lock()
+	if err := c.writeErr(); err != nil {
+		c.mu.Unlock()
+		return 0, err
+	}
+	seq := c.nextUSeq
+	c.nextUSeq++
+	c.mu.Unlock()
+
+	packet := binary.AppendUvarint([]byte{udpUnreliable}, seq)
+	packet = append(packet, b...)
+	if _, err := c.pc.WriteTo(packet, c.raddr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// writeErr must be called with c.mu held.
+func (c *udpConn) writeErr() error {
+	select {
+	case <-c.closed:
+		return net.ErrClosed
+	default:
+	}
+	if c.failure != nil {
+		return c.failure
+	}
+	if c.eof {
+		return io.ErrClosedPipe
+	}
+	return nil
+}
+
+func (c *udpConn) Read(p []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if len(c.current) == 0 && len(c.inbox) > 0 {
+			c.current, c.inbox = c.inbox[0], c.inbox[1:]
+		}
+		if len(c.current) > 0 {
+			n := copy(p, c.current)
+			c.current = c.current[n:]
+			c.mu.Unlock()
+			return n, nil
+		}
+		failure, eof := c.failure, c.eof
+		c.mu.Unlock()
+		if failure != nil {
+			return 0, failure
+		}
+		if eof {
+			return 0, io.EOF
+		}
+
+		select {
+		case <-c.notify:
+		case <-c.closed:
+			return 0, net.ErrClosed
+		case <-c.readDL.wait():
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// handlePacket processes one datagram from the remote side.
+func (c *udpConn) handlePacket(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	kind, body := b[0], b[1:]
+	switch kind {
+	case udpOpen:
+		if len(body) < udpCookieSize {
+			return
+		}
+		body = body[udpCookieSize:]
+		fallthrough
+	case udpReliable:
+		seq, n := binary.Uvarint(body)
+		if n <= 0 {
+			return
+		}
+		c.receiveReliable(seq, body[n:])
+	case udpUnreliable:
+		seq, n := binary.Uvarint(body)
+		if n <= 0 {
+			return
+		}
+		c.mu.Lock()
+		if seq > c.lastUSeq && len(c.inbox) < udpInboxSize {
+			c.lastUSeq = seq
+			c.inbox = append(c.inbox, append([]byte(nil), body[n:]...))
+			c.signal()
+		}
+		c.mu.Unlock()
+	case udpAck:
+		cum, n := binary.Uvarint(body)
+		if n <= 0 || len(body[n:]) != 8 {
+			return
+		}
+		c.receiveAck(cum, binary.BigEndian.Uint64(body[n:]))
+	case udpClose:
+		c.mu.Lock()
+		c.eof = true
+		c.pending = make(map[uint64]*udpPending)
+		c.signal()
+		c.mu.Unlock()
+	}
+}
+
+func (c *udpConn) receiveReliable(seq uint64, payload []byte) {
+	c.mu.Lock()
+	switch {
+	case seq < c.expected:
+		// Already delivered; the ack was lost.
+	case seq >= c.expected+udpWindow:
+		c.mu.Unlock()
+		return
+	case len(c.inbox) >= udpInboxSize:
+		// The reader is behind: refuse the packet and let it be resent.
+		c.mu.Unlock()
+		return
+	default:
+		if _, dup := c.early[seq]; !dup {
+			c.early[seq] = append([]byte(nil), payload...)
+		}
+		for {
+			next, ok := c.early[c.expected]
+			if !ok {
+				break
+			}
+			delete(c.early, c.expected)
+			c.inbox = append(c.inbox, next)
+			c.expected++
+		}
+		c.signal()
+	}
+	ack := c.ackPacket()
+	c.mu.Unlock()
+	_, _ = c.pc.WriteTo(ack, c.raddr)
+}
+
+// ackPacket acknowledges everything up to expected-1 plus a bitmap of the
+// 64 packets after it that arrived early. c.mu must be held.
+func (c *udpConn) ackPacket() []byte {
+	var bits uint64
+	for i := uint64(0); i < 64; i++ {
+		if _, ok := c.early[c.expected+1+i]; ok {
+			bits |= 1 << i
+		}
+	}
+	b := binary.AppendUvarint([]byte{udpAck}, c.expected-1)
+	return binary.BigEndian.AppendUint64(b, bits)
+}
+
+func (c *udpConn) receiveAck(cum, bits uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for seq := range c.pending {
+		if seq <= cum || (seq > cum+1 && seq-cum-2 < 64 && bits&(1<<(seq-cum-2)) != 0) {
+			delete(c.pending, seq)
+		}
+	}
+	if len(c.pending) == 0 {
+		select {
+		case c.acked <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *udpConn) retransmitLoop() {
+	t := time.NewTicker(udpRetransmitInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-t.C:
+			var resend [][]byte
+			c.mu.Lock()
+			for _, p := range c.pending {
+				if now.Sub(p.sentAt) < udpRetransmitTimeout {
+					continue
+				}
+				if p.tries >= udpMaxRetransmits {
+					c.failure = errUDPPeerUnreachable
+					c.pending = make(map[uint64]*udpPending)
+					c.signal()
+					resend = nil
+					break
+				}
+				p.tries++
+				p.sentAt = now
+				resend = append(resend, p.packet)
+			}
+			c.mu.Unlock()
+			for _, b := range resend {
+				_, _ = c.pc.WriteTo(b, c.raddr)
+			}
+		}
+	}
+}
+
+// signal wakes a blocked Read. c.mu must be held.
+func (c *udpConn) signal() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Close returns at once. In the background it keeps retransmitting for up
+// to udpLinger until outstanding reliable messages are acknowledged, then
+// tells the remote side and releases the connection.
+func (c *udpConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mu.Lock()
+		waiting := len(c.pending) > 0 && c.failure == nil && !c.eof
+		c.mu.Unlock()
+		go func() {
+			if waiting {
+				select {
+				case <-c.acked:
+				case <-time.After(udpLinger):
+				}
+			}
+			_, _ = c.pc.WriteTo([]byte{udpClose}, c.raddr)
+			close(c.done)
+			if c.onClose != nil {
+				c.onClose()
+			}
+		}()
+	})
+	return nil
+}
+
+// discard drops a connection that was never handed out.
+func (c *udpConn) discard() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		close(c.done)
+	})
+}
+
+func (c *udpConn) LocalAddr() net.Addr  { return c.pc.LocalAddr() }
+func (c *udpConn) RemoteAddr() net.Addr { return c.raddr }
+
+func (c *udpConn) SetDeadline(t time.Time) error {
+	c.readDL.set(t)
+	return nil
+}
+
+func (c *udpConn) SetReadDeadline(t time.Time) error {
+	c.readDL.set(t)
+	return nil
+}
+
+// SetWriteDeadline is a no-op: writes never block, a full window fails
+// immediately instead.
+func (c *udpConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// UDPListener demultiplexes datagrams on one socket into connections, one
+// per remote address. A connection starts with the first reliable packet
+// from an unknown address, sent with a cookie the listener issued to it.
+type UDPListener struct {
+	pc       net.PacketConn
+	secret   []byte
+	accepted chan *udpConn
+	done     chan struct{}
+
+	mu        sync.Mutex
+	conns     map[string]*udpConn
+	closed    bool
+	closeOnce sync.Once
+}
+
+func NewUDPListener(pc net.PacketConn) *UDPListener {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	l := &UDPListener{
+		pc:       pc,
+		secret:   secret,
+		accepted: make(chan *udpConn, 16),
+		done:     make(chan struct{}),
+		conns:    make(map[string]*udpConn),
+	}
+	go l.readLoop()
+	return l
+}
+
+func (l *UDPListener) readLoop() {
+	buf := make([]byte, udpMaxDatagram+16)
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		if buf[0] == udpHello {
+			if n >= udpHelloSize {
+				reply := append([]byte{udpCookie}, l.cookie(addr, time.Now())...)
+				_, _ = l.pc.WriteTo(reply, addr)
+			}
+			continue
+		}
+		key := addr.String()
+		l.mu.Lock()
+		c, ok := l.conns[key]
+		if !ok && !l.closed && l.opensConnection(buf[:n], addr) {
+			c = newUDPConn(l.pc, addr, func() { l.remove(key) })
+			select {
+			case l.accepted <- c:
+				l.conns[key] = c
+			default:
+				// Accept backlog full; the client will retry.
+				c.discard()
+				c = nil
+			}
+		}
+		l.mu.Unlock()
+		if c != nil {
+			c.handlePacket(buf[:n])
+		}
+	}
+}
+
+// opensConnection reports whether b is the first reliable packet of a
+// connection, carrying a cookie issued to addr. Late retransmissions from a
+// connection that already ended must not start a new one, so the cookie
+// expires.
+func (l *UDPListener) opensConnection(b []byte, addr net.Addr) bool {
+	if b[0] != udpOpen || len(b) < 1+udpCookieSize {
+		return false
+	}
+	if !l.validCookie(addr, b[1:1+udpCookieSize], time.Now()) {
+		return false
+	}
+	seq, n := binary.Uvarint(b[1+udpCookieSize:])
+	return n > 0 && seq == 1
+}
+
+// cookie binds addr to the time t, truncated to seconds.
+func (l *UDPListener) cookie(addr net.Addr, t time.Time) []byte {
+	b := binary.BigEndian.AppendUint64(nil, uint64(t.Unix()))
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(addr.String()))
+	mac.Write(b)
+	return mac.Sum(b)[:udpCookieSize]
+}
+
+func (l *UDPListener) validCookie(addr net.Addr, cookie []byte, now time.Time) bool {
+	issued := time.Unix(int64(binary.BigEndian.Uint64(cookie)), 0)
+	if now.Sub(issued) > udpCookieLifetime || issued.After(now.Add(time.Second)) {
+		return false
+	}
+	return hmac.Equal(cookie, l.cookie(addr, issued))
+}
+
+func (l *UDPListener) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.conns, key)
+	if l.closed && len(l.conns) == 0 {
+		_ = l.pc.Close()
+	}
+}
+
+func (l *UDPListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.accepted:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting connections. The socket stays open until the
+// connections already accepted are closed.
+func (l *UDPListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.closed = true
+		close(l.done)
+		// Connections that were never accepted are dropped.
+	drop:
+		for {
+			select {
+			case c := <-l.accepted:
+				delete(l.conns, c.raddr.String())
+				c.discard()
+			default:
+				break drop
+			}
+		}
+		if len(l.conns) == 0 {
+			_ = l.pc.Close()
+		}
+	})
+	return nil
+}
+
+func (l *UDPListener) Addr() net.Addr {
+	return l.pc.LocalAddr()
+}
+
+// DialUDP connects to a server's UDP listener. The address may be given as
+// host:port or udp://host:port.
+func DialUDP(ctx context.Context, addr string) (net.Conn, error) {
+	if u, err := url.Parse(addr); err == nil && u.Scheme == "udp" {
+		addr = u.Host
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	pc := conn.(*net.UDPConn)
+	cookie, err := fetchCookie(ctx, pc)
+	if err != nil {
+		_ = pc.Close()
+		return nil, err
+	}
+	c := newUDPConn(connectedPacketConn{pc}, pc.RemoteAddr(), func() { _ = pc.Close() })
+	c.cookie = cookie
+	go func() {
+		buf := make([]byte, udpMaxDatagram+16)
+		for {
+			n, err := pc.Read(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			c.handlePacket(buf[:n])
+		}
+	}()
+	return c, nil
+}
+
+// fetchCookie asks the listener for the cookie that lets this address open
+// a connection, resending the request while it goes unanswered.
+func fetchCookie(ctx context.Context, pc *net.UDPConn) ([]byte, error) {
+	hello := make([]byte, udpHelloSize)
+	hello[0] = udpHello
+	buf := make([]byte, udpMaxDatagram+16)
+	defer func() { _ = pc.SetReadDeadline(time.Time{}) }()
+	for range udpMaxRetransmits {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, err := pc.Write(hello); err != nil {
+			return nil, err
+		}
+		wait := time.Now().Add(udpRetransmitTimeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(wait) {
+			wait = d
+		}
+		_ = pc.SetReadDeadline(wait)
+		for {
+			n, err := pc.Read(buf)
+			if err != nil {
+				break
+			}
+			if n == 1+udpCookieSize && buf[0] == udpCookie {
+				return append([]byte(nil), buf[1:n]...), nil
+			}
+		}
+	}
+	return nil, errUDPPeerUnreachable
+}
+
+// connectedPacketConn lets a connected UDP socket be used where WriteTo is
+// expected.
+type connectedPacketConn struct {
+	*net.UDPConn
+}
+
+func (c connectedPacketConn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	return c.Write(b)
+}
+
+// deadline is a resettable timer channel, closed when the deadline passes.
+type deadline struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired chan struct{}
+}
+
+func makeDeadline() deadline {
+	return deadline{expired: make(chan struct{})}
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.expired
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.expired)
+	if t.IsZero() {
+		if closed {
+			d.expired = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.expired = make(chan struct{})
+		}
+		ch := d.expired
+		d.timer = time.AfterFunc(dur, func() { close(ch) })
+		return
+	}
+	if !closed {
+		close(d.expired)
+	}
+}
+
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,37 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+)
+
+// ErrUDPWithTLS is returned by ServeUDP when a TLS certificate is
+// configured: UDP cannot be encrypted and would expose the handshake.
+var ErrUDPWithTLS = errors.New("UDP is unencrypted and disabled with TLS")
+
+func (s *Server) ListenAndServeUDP(ctx context.Context) error {
+	if s.cfg.TLSCertFile != "" || s.cfg.TLSKeyFile != "" {
+		return ErrUDPWithTLS
+	}
+	pc, err := net.ListenPacket("udp", s.cfg.UDPAddr)
+	if err != nil {
+		return err
+	}
+	log.Printf("UDP on %s", s.cfg.UDPAddr)
+	return s.ServeUDP(ctx, pc)
+}
+
+// ServeUDP is Serve for UDP clients on pc. The socket is closed once the
+// listener and every connection on it are. UDP is never encrypted, so it
+// refuses to start when a TLS certificate is configured.
+func (s *Server) ServeUDP(ctx context.Context, pc net.PacketConn) error {
+	if s.cfg.TLSCertFile != "" || s.cfg.TLSKeyFile != "" {
+		_ = pc.Close()
+		return ErrUDPWithTLS
+	}
+	ln := NewUDPListener(pc)
+	defer ln.Close()
+	return s.serve(ctx, ln)
+}
@@ -0,0 +1,369 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A minimal RFC 6455 implementation, enough to carry the game protocol.
+// wsConn turns a WebSocket into a byte stream so the rest of the package
+// can treat it like any other net.Conn: message boundaries are ignored on
+// read and every Write becomes one message.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsContinuation byte = 0x0
+	wsText         byte = 0x1
+	wsBinary       byte = 0x2
+	wsClose        byte = 0x8
+	wsPing         byte = 0x9
+	wsPong         byte = 0xA
+)
+
+const (
+	wsFin             = 0x80
+	wsMasked          = 0x80
+	wsMaxControlFrame = 125
+	wsCloseTimeout    = time.Second
+)
+
+var (
+	errWebSocketProtocol  = errors.New("websocket protocol error")
+	errWebSocketHandshake = errors.New("websocket handshake failed")
+)
+
+type wsConn struct {
+	net.Conn
+	r *bufio.Reader
+	// client connections mask what they send and expect unmasked frames.
+	client bool
+	binary atomic.Bool
+
+	// Read state, only touched by the reading goroutine.
+	remaining int64
+	masked    bool
+	mask      [4]byte
+	maskPos   int
+
+	wmu       sync.Mutex
+	closeOnce sync.Once
+}
+
+// setBinary switches outgoing messages from text to binary frames. Text is
+// used until a binary codec has been negotiated so browsers can read the
+// handshake and JSON messages directly.
+func (c *wsConn) setBinary(b bool) {
+	c.binary.Store(b)
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if err := c.nextDataFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	if c.masked {
+		for i := range p[:n] {
+			p[i] ^= c.mask[c.maskPos&3]
+			c.maskPos++
+		}
+	}
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// nextDataFrame reads frame headers until one with payload arrives,
+// answering control frames on the way.
+func (c *wsConn) nextDataFrame() error {
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(c.r, h[:]); err != nil {
+			return err
+		}
+		fin, op := h[0]&wsFin != 0, h[0]&0x0F
+		if h[0]&0x70 != 0 {
+			return errWebSocketProtocol
+		}
+		masked := h[1]&wsMasked != 0
+		if masked == c.client {
+			// Clients must mask, servers must not.
+			return errWebSocketProtocol
+		}
+		length := int64(h[1] & 0x7F)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return err
+			}
+			length = int64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+				return err
+			}
+			v := binary.BigEndian.Uint64(ext[:])
+			if v > 1<<62 {
+				return errWebSocketProtocol
+			}
+			length = int64(v)
+		}
+		var mask [4]byte
+		if masked {
+			if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+				return err
+			}
+		}
+
+		switch op {
+		case wsContinuation, wsText, wsBinary:
+			c.remaining, c.masked, c.mask, c.maskPos = length, masked, mask, 0
+			return nil
+		case wsClose, wsPing, wsPong:
+			if !fin || length > wsMaxControlFrame {
+				return errWebSocketProtocol
+			}
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(c.r, payload); err != nil {
+				return err
+			}
+			if masked {
+				for i := range payload {
+					payload[i] ^= mask[i&3]
+				}
+			}
+			switch op {
+			case wsPing:
+				if err := c.writeFrame(wsPong, payload); err != nil {
+					return err
+				}
+			case wsClose:
+				_ = c.writeFrame(wsClose, payload)
+				return io.EOF
+			}
+		default:
+			return errWebSocketProtocol
+		}
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	op := wsText
+	if c.binary.Load() {
+		op = wsBinary
+	}
+	if err := c.writeFrame(op, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, wsFin|op)
+	var maskBit byte
+	if c.client {
+		maskBit = wsMasked
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		_, _ = rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= mask[i&3]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// Close sends a close frame, without waiting for the reply, and closes the
+// connection.
+func (c *wsConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		_ = c.Conn.SetWriteDeadline(time.Now().Add(wsCloseTimeout))
+		_ = c.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, 1000))
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+func websocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket completes the server side of the opening handshake and
+// takes over the connection.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") ||
+		!headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errWebSocketHandshake
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errWebSocketHandshake
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		http.Error(w, "bad Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errWebSocketHandshake
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errWebSocketHandshake
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{Conn: conn, r: rw.Reader}, nil
+}
+
+// DialWebSocket opens a WebSocket to a ws:// or wss:// URL and returns it as
+// a byte stream. NewClient uses it for addresses with those schemes. tc
+// configures TLS for wss:// and may be nil.
+func DialWebSocket(ctx context.Context, rawURL string, tc *tls.Config) (net.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	var port string
+	switch u.Scheme {
+	case "ws":
+		port = "80"
+	case "wss":
+		port = "443"
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var conn net.Conn
+	if u.Scheme == "wss" {
+		d := tls.Dialer{Config: tc}
+		conn, err = d.DialContext(ctx, "tcp", host)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ws, err := websocketHandshake(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+func websocketHandshake(conn net.Conn, u *url.URL) (*wsConn, error) {
+	_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+		Host: u.Host,
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return nil, fmt.Errorf("%w: %s", errWebSocketHandshake, resp.Status)
+	}
+	return &wsConn{Conn: conn, r: br, client: true}, nil
+}
+
+// setFraming picks the frame type for what was negotiated when conn is a
+// WebSocket: binary frames for the binary codec or compressed streams.
+func setFraming(conn net.Conn, codec Codec, compression string) {
+	if ws, ok := conn.(*wsConn); ok {
+		ws.setBinary(codec == BinaryCodec || compression != "")
+	}
+}
@@ -0,0 +1,70 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+)
+
+// WebSocketHandler serves the game protocol to WebSocket clients. The
+// handshake and messages are the same as over TCP; a player's transport is
+// invisible to the game service.
+func (s *Server) WebSocketHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.shuttingDown() {
+			http.Error(w, errShuttingDown, http.StatusServiceUnavailable)
+			return
+		}
+		ws, err := upgradeWebSocket(w, r)
+		if err != nil {
+			log.Printf("websocket upgrade from %s failed: %v", r.RemoteAddr, err)
+			return
+		}
+		if !s.track(ws) {
+			_ = ws.Close()
+			return
+		}
+		s.handle(ws)
+	})
+}
+
+func (s *Server) ListenAndServeWebSocket(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.WebSocketAddr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	log.Printf("WebSocket on %s%s", s.cfg.WebSocketAddr, s.cfg.WebSocketPath)
+	return s.ServeWebSocket(ctx, ln)
+}
+
+// ServeWebSocket is Serve for WebSocket clients, using the standard HTTP
+// server to accept the upgrade requests.
+func (s *Server) ServeWebSocket(ctx context.Context, ln net.Listener) error {
+	ln, err := s.tlsListener(ln)
+	if err != nil {
+		return err
+	}
+	if !s.addListener(ln) {
+		return ErrServerClosed
+	}
+	defer s.removeListener(ln)
+
+	mux := http.NewServeMux()
+	mux.Handle(s.cfg.WebSocketPath, s.WebSocketHandler())
+	hs := &http.Server{Handler: mux, ReadHeaderTimeout: handshakeTimeout}
+	stop := context.AfterFunc(ctx, func() { _ = hs.Close() })
+	defer stop()
+
+	s.startBroadcast(ctx)
+	err = hs.Serve(ln)
+	if ctx.Err() != nil {
+		return s.shutdownAfterCancel()
+	}
+	if errors.Is(err, net.ErrClosed) && s.shuttingDown() {
+		return ErrServerClosed
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package application
+
+import (
+	"math"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAttack_ReportsWhyItFailed(t *testing.T) {
+	world := domain.NewWorld(1000, 1000)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return().Maybe()
+	gameService := services.NewGameService(world, logger, &services.WorldSnapshotService{})
+
+	world.Characters["w"] = domain.NewWarrior("w", 0, 0)
+	world.Characters["far"] = domain.NewMage("far", 900, 900)
+	dead := domain.NewMage("dead", 1, 1)
+	dead.TakeDamage(1000, domain.Physical)
+	world.Characters["dead"] = dead
+
+	attack := func(attacker, target string) error {
+		return gameService.ProcessCommand(command.Command{
+			Type:        command.ATTACK,
+			CharacterID: attacker,
+			Data:        map[string]interface{}{"target_id": target},
+		})
+	}
+
+	cases := []struct {
+		name     string
+		attacker string
+		target   string
+		code     services.ErrorCode
+	}{
+		{"unknown attacker", "ghost", "far", services.CodeCharacterNotFound},
+		{"unknown target", "w", "ghost", services.CodeTargetNotFound},
+		{"dead target", "w", "dead", services.CodeTargetDead},
+		{"out of range", "w", "far", services.CodeOutOfRange},
+		{"dead attacker", "dead", "w", services.CodeCharacterDead},
+		{"self", "w", "w", services.CodeInvalidArgument},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := attack(tc.attacker, tc.target)
+			assert.Error(t, err)
+			assert.Equal(t, tc.code, services.ErrorCodeOf(err))
+		})
+	}
+
+	assert.Equal(t, services.CodeInvalidArgument, services.ErrorCodeOf(gameService.ProcessCommand(command.Command{
+		Type:        command.ATTACK,
+		CharacterID: "w",
+		Data:        map[string]interface{}{},
+	})))
+}
+
+func TestAttack_CastsAbilities(t *testing.T) {
+	world := domain.NewWorld(1000, 1000)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return().Maybe()
+	gameService := services.NewGameService(world, logger, &services.WorldSnapshotService{})
+	world.Characters["m"] = domain.NewMage("m", 0, 0)
+	world.Characters["w"] = domain.NewWarrior("w", 100, 0)
+
+	cast := func(typ command.Type, data map[string]interface{}) error {
+		return gameService.ProcessCommand(command.Command{Type: typ, CharacterID: "m", Data: data})
+	}
+
+	assert.Equal(t, services.CodeInvalidArgument, services.ErrorCodeOf(cast(command.CAST, map[string]interface{}{"target_id": "w"})),
+		"CAST must name the ability")
+	assert.Equal(t, services.CodeInvalidArgument, services.ErrorCodeOf(cast(command.CAST, map[string]interface{}{"ability": "slash", "target_id": "w"})),
+		"mages cannot slash")
+
+	assert.NoError(t, cast(command.CAST, map[string]interface{}{"ability": "frostbolt", "target_id": "w"}))
+	assert.Equal(t, services.CodeBusy, services.ErrorCodeOf(cast(command.ATTACK, map[string]interface{}{"target_id": "w"})))
+	for range 30 {
+		gameService.UpdateWorld(1.0 / 60)
+	}
+	events := gameService.DrainEvents()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "frostbolt", events[0].Ability)
+	assert.Equal(t, "w", events[0].Target)
+	assert.NotEmpty(t, world.Characters["w"].Effects())
+
+	assert.Equal(t, services.CodeOnCooldown, services.ErrorCodeOf(cast(command.CAST, map[string]interface{}{"ability": "frostbolt", "target_id": "w"})))
+	assert.NoError(t, cast(command.ATTACK, map[string]interface{}{"target_id": "w"}), "ATTACK uses the primary ability")
+
+	ws := gameService.BuildWorldSnapshot()
+	for _, c := range ws.Characters {
+		if c.ID == "m" {
+			assert.Equal(t, "fireball", c.Abilities[0].Name)
+			assert.Positive(t, c.Abilities[1].Cooldown)
+			assert.Less(t, c.Energy, 100.0)
+		}
+	}
+}
+
+func TestAttack_AimsAtPointsAndDirections(t *testing.T) {
+	world := domain.NewWorld(1000, 1000)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return().Maybe()
+	gameService := services.NewGameService(world, logger, &services.WorldSnapshotService{})
+	world.Characters["w"] = domain.NewWarrior("w", 500, 500)
+	world.Characters["m"] = domain.NewMage("m", 100, 100)
+	world.Characters["left"] = domain.NewMage("left", 400, 500)
+	world.Characters["right"] = domain.NewMage("right", 600, 500)
+
+	cast := func(id string, data map[string]interface{}) error {
+		return gameService.ProcessCommand(command.Command{Type: command.CAST, CharacterID: id, Data: data})
+	}
+
+	assert.Equal(t, services.CodeInvalidArgument, services.ErrorCodeOf(cast("w", map[string]interface{}{"ability": "cleave"})),
+		"cones need an aim")
+	assert.Equal(t, services.CodeInvalidArgument, services.ErrorCodeOf(cast("w", map[string]interface{}{"ability": "cleave", "dx": 0.0, "dy": 0.0})))
+	assert.Equal(t, services.CodeOutOfRange, services.ErrorCodeOf(cast("m", map[string]interface{}{"ability": "blast", "x": 900.0, "y": 900.0})))
+
+	assert.NoError(t, cast("w", map[string]interface{}{"ability": "cleave", "dx": -1.0, "dy": 0.0}))
+	assert.NoError(t, cast("m", map[string]interface{}{"ability": "blast", "x": 400.0, "y": 300.0}))
+	gameService.UpdateWorld(1.0 / 60)
+
+	events := gameService.DrainEvents()
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "cleave", events[0].Ability)
+		assert.Equal(t, "left", events[0].Target)
+	}
+
+	ws := gameService.BuildWorldSnapshot()
+	for _, c := range ws.Characters {
+		if c.ID == "w" {
+			assert.InDelta(t, math.Pi, c.Facing, 1e-9)
+		}
+	}
+}
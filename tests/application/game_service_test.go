@@ -9,6 +9,7 @@ import (
 	"meatgrinder/internal/application/command"
 	"meatgrinder/internal/application/services"
 	"meatgrinder/internal/domain"
+	"strings"
 	"testing"
 )
 
@@ -63,7 +64,7 @@ func TestGameService_ProcessCommand(t *testing.T) {
 		processCommandErr := gameService.ProcessCommand(cmd)
 		assert.NoError(t, processCommandErr)
 
-		world.Update()
+		world.Update(1.0 / 60)
 		x, y := character.Position()
 
 		assert.NotEqual(t, initialX, x)
@@ -96,7 +97,7 @@ func TestGameService_ProcessCommand(t *testing.T) {
 			Data:        map[string]interface{}{"target_id": targetId},
 		})
 
-		gameService.UpdateWorld()
+		gameService.UpdateWorld(1.0 / 60)
 
 		assert.NotNil(t, world.Characters[attackerId])
 		assert.NotNil(t, world.Characters[targetId])
@@ -126,3 +127,77 @@ func TestGameService_ProcessCommand(t *testing.T) {
 		assert.Equal(t, "unknown cmd 0", err.Error())
 	})
 }
+
+func TestGameService_ShutdownLogsFinalState(t *testing.T) {
+	world := domain.NewWorld(1000, 1000)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return()
+	gameService := services.NewGameService(world, logger, &services.WorldSnapshotService{})
+	_ = gameService.ProcessCommand(command.Command{Type: command.SPAWN, CharacterID: "survivor"})
+
+	gameService.Shutdown()
+
+	logger.AssertCalled(t, "LogEvent", mock.MatchedBy(func(s string) bool {
+		return strings.HasPrefix(s, "final state: survivor ")
+	}))
+	logger.AssertCalled(t, "LogEvent", "server stopped with 1 characters")
+}
+
+func TestGameService_StampsTickAndLastInput(t *testing.T) {
+	world := domain.NewWorld(1000, 1000)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return()
+	gameService := services.NewGameService(world, logger, &services.WorldSnapshotService{})
+
+	gameService.Enqueue(command.DTO{Type: command.SPAWN, CharacterID: "p1", Seq: 1, Data: map[string]interface{}{}}, nil)
+	gameService.Enqueue(command.DTO{Type: command.MOVE, CharacterID: "p1", Seq: 2, Data: map[string]interface{}{"dx": 1.0, "dy": 0.0}}, nil)
+	gameService.Tick(1.0 / 60)
+	gameService.Tick(1.0 / 60)
+
+	ws := gameService.BuildWorldSnapshot()
+	assert.Equal(t, uint64(2), ws.Tick)
+	assert.NotZero(t, ws.ServerTime)
+	assert.Len(t, ws.Characters, 1)
+	assert.Equal(t, uint64(2), ws.Characters[0].InputSeq)
+
+	gameService.Enqueue(command.DTO{Type: command.MOVE, CharacterID: "p1", Seq: 4, Data: map[string]interface{}{"dx": 0.0, "dy": 0.0}}, nil)
+	gameService.Enqueue(command.DTO{Type: command.ATTACK, CharacterID: "p1", Seq: 3, Data: map[string]interface{}{}}, nil)
+	gameService.Tick(1.0 / 60)
+
+	ws = gameService.BuildWorldSnapshot()
+	assert.Equal(t, uint64(4), ws.Characters[0].InputSeq, "a late command does not move the acknowledged input back")
+}
+
+func TestGameService_IgnoresLateMoves(t *testing.T) {
+	world := domain.NewWorld(1000, 1000)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return()
+	gameService := services.NewGameService(world, logger, &services.WorldSnapshotService{})
+	world.Characters["p1"] = domain.NewWarrior("p1", 500, 500)
+
+	gameService.Enqueue(command.DTO{Type: command.MOVE, CharacterID: "p1", Seq: 6, Data: map[string]interface{}{"dx": 0.0, "dy": 0.0}}, nil)
+	gameService.Enqueue(command.DTO{Type: command.MOVE, CharacterID: "p1", Seq: 5, Data: map[string]interface{}{"dx": 1.0, "dy": 0.0}}, nil)
+	gameService.Tick(1.0 / 60)
+
+	vx, vy := world.Characters["p1"].Velocity()
+	assert.Zero(t, vx, "a repeat older than the stop must not restart the character")
+	assert.Zero(t, vy)
+}
+
+func TestGameService_DisconnectsWhenQueueIsFull(t *testing.T) {
+	world := domain.NewWorld(1000, 1000)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return()
+	gameService := services.NewGameService(world, logger, &services.WorldSnapshotService{})
+	world.Characters["p1"] = domain.NewWarrior("p1", 500, 500)
+	world.Characters["p2"] = domain.NewMage("p2", 100, 100)
+
+	move := command.DTO{Type: command.MOVE, CharacterID: "p2", Data: map[string]interface{}{"dx": 1.0, "dy": 0.0}}
+	for gameService.Enqueue(move, nil) == nil {
+	}
+	gameService.Disconnect("p1")
+	gameService.Tick(1.0 / 60)
+
+	assert.NotContains(t, world.Characters, "p1", "a full command queue must not drop a disconnect")
+	assert.Contains(t, world.Characters, "p2")
+}
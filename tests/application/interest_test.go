@@ -0,0 +1,53 @@
+package application
+
+import (
+	"meatgrinder/internal/application/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ids(ws services.WorldSnapshot) []string {
+	var out []string
+	for _, c := range ws.Characters {
+		out = append(out, c.ID)
+	}
+	return out
+}
+
+func TestInterest_View(t *testing.T) {
+	world := services.WorldSnapshot{Tick: 3, ServerTime: 42, Characters: []services.CharacterSnapshot{
+		{ID: "me", X: 100, Y: 100},
+		{ID: "near", X: 130, Y: 140},
+		{ID: "far", X: 600, Y: 600},
+		{ID: "boss", X: 700, Y: 20, AlwaysRelevant: true},
+	}}
+	in := services.Interest{Radius: 50}
+
+	view := in.View(world, "me")
+	assert.Equal(t, []string{"me", "near", "boss"}, ids(view))
+	assert.Equal(t, uint64(3), view.Tick)
+	assert.Equal(t, int64(42), view.ServerTime)
+	assert.Equal(t, []string{"far", "boss"}, ids(in.View(world, "far")))
+	assert.Len(t, in.View(world, "spectator").Characters, 4, "viewers without a character see everything")
+	assert.Len(t, services.Interest{}.View(world, "me").Characters, 4, "a zero radius disables filtering")
+}
+
+func TestDiffViews_DespawnsCharactersLeavingInterest(t *testing.T) {
+	base := services.WorldSnapshot{Characters: []services.CharacterSnapshot{
+		{ID: "me", X: 100, Y: 100},
+		{ID: "walker", X: 120, Y: 100},
+		{ID: "victim", X: 90, Y: 100},
+	}}
+	world := services.WorldSnapshot{Characters: []services.CharacterSnapshot{
+		{ID: "me", X: 100, Y: 100},
+		{ID: "walker", X: 400, Y: 100},
+	}}
+	cur := services.Interest{Radius: 50}.View(world, "me")
+
+	d := services.DiffViews(base, cur, world)
+
+	assert.Equal(t, []string{"walker"}, d.Despawned)
+	assert.Equal(t, []string{"victim"}, d.Removed)
+	assert.Equal(t, []string{"me"}, ids(services.ApplyDelta(base, d)))
+}
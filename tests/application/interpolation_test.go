@@ -0,0 +1,78 @@
+package application
+
+import (
+	"meatgrinder/internal/application/interpolation"
+	"meatgrinder/internal/application/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var epoch = time.Unix(1700000000, 0)
+
+func snapAt(ms int, chars ...services.CharacterSnapshot) services.WorldSnapshot {
+	return services.WorldSnapshot{ServerTime: epoch.Add(time.Duration(ms) * time.Millisecond).UnixNano(), Characters: chars}
+}
+
+func at(ms int) time.Time {
+	return epoch.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func TestBuffer_InterpolatesBehindServer(t *testing.T) {
+	b := interpolation.NewBuffer(100*time.Millisecond, 100*time.Millisecond)
+	b.Push(snapAt(0, services.CharacterSnapshot{ID: "a", State: "idle", X: 0}), at(0))
+	b.Push(snapAt(200, services.CharacterSnapshot{ID: "a", State: "running", Health: 50, X: 100}), at(200))
+
+	got := b.Sample(at(250))
+	assert.InDelta(t, 75.0, got[0].X, 1e-6)
+	assert.Equal(t, "idle", got[0].State, "state changes when the timeline reaches the snapshot")
+
+	got = b.Sample(at(300))
+	assert.InDelta(t, 100.0, got[0].X, 1e-6)
+	assert.Equal(t, "running", got[0].State)
+	assert.Equal(t, 50.0, got[0].Health)
+}
+
+func TestBuffer_BoundsExtrapolation(t *testing.T) {
+	b := interpolation.NewBuffer(0, 100*time.Millisecond)
+	b.Push(snapAt(0, services.CharacterSnapshot{ID: "a", State: "running", X: 0}, services.CharacterSnapshot{ID: "b", State: "idle", X: 0}), at(0))
+	b.Push(snapAt(200, services.CharacterSnapshot{ID: "a", State: "running", X: 100}, services.CharacterSnapshot{ID: "b", State: "idle", X: 10}), at(200))
+
+	got := b.Sample(at(250))
+	assert.InDelta(t, 125.0, got[0].X, 1e-6)
+	assert.InDelta(t, 10.0, got[1].X, 1e-6, "characters that stopped are not extrapolated")
+
+	got = b.Sample(at(1000))
+	assert.InDelta(t, 150.0, got[0].X, 1e-6)
+}
+
+func TestBuffer_OrdersLateSnapshots(t *testing.T) {
+	b := interpolation.NewBuffer(100*time.Millisecond, 0)
+	b.Push(snapAt(0, services.CharacterSnapshot{ID: "a", X: 0}), at(0))
+	b.Push(snapAt(200, services.CharacterSnapshot{ID: "a", X: 200}), at(200))
+	b.Push(snapAt(100, services.CharacterSnapshot{ID: "a", X: 50}), at(200))
+	b.Push(snapAt(100, services.CharacterSnapshot{ID: "a", X: 50}), at(200))
+	assert.Equal(t, 3, b.Len())
+
+	// The late snapshot pulls the clock estimate back by a tenth of its 100ms
+	// lateness, so the timeline is at 140ms: between the 100 and 200 ones.
+	got := b.Sample(at(250))
+	assert.InDelta(t, 110.0, got[0].X, 1e-6)
+	assert.Equal(t, 2, b.Len(), "snapshots the timeline moved past are dropped")
+}
+
+func TestBuffer_ProjectilesFollowVelocity(t *testing.T) {
+	b := interpolation.NewBuffer(100*time.Millisecond, 100*time.Millisecond)
+	ws := snapAt(0)
+	ws.Projectiles = []services.ProjectileSnapshot{{ID: 1, X: 10, Y: 20, VX: 600, VY: -100}}
+	b.Push(ws, at(0))
+	b.Push(snapAt(200), at(200))
+
+	got := b.Projectiles(at(200))
+	if assert.Len(t, got, 1) {
+		assert.InDelta(t, 70.0, got[0].X, 1e-6)
+		assert.InDelta(t, 10.0, got[0].Y, 1e-6)
+	}
+	assert.Empty(t, b.Projectiles(at(300)), "gone once the timeline reaches the snapshot without it")
+}
@@ -0,0 +1,97 @@
+package application
+
+import (
+	"math"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func movingWorld(t *testing.T) (*domain.World, *services.GameService) {
+	t.Helper()
+	world := domain.NewWorld(800, 800)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return()
+	return world, services.NewGameService(world, logger, services.NewWorldSnapshotService())
+}
+
+func move(t *testing.T, gs *services.GameService, id string, dx, dy float64) {
+	t.Helper()
+	err := gs.ProcessCommand(command.Command{Type: command.MOVE, CharacterID: id, Data: map[string]interface{}{"dx": dx, "dy": dy}})
+	assert.NoError(t, err)
+}
+
+func distance(c domain.Character, x0, y0 float64) float64 {
+	x, y := c.Position()
+	return math.Hypot(x-x0, y-y0)
+}
+
+func TestMovement_SpeedIndependentOfDirectionAndRate(t *testing.T) {
+	world, gs := movingWorld(t)
+	straight := domain.NewWarrior("straight", 100, 100)
+	diagonal := domain.NewWarrior("diagonal", 100, 300)
+	spammed := domain.NewWarrior("spammed", 100, 500)
+	world.Characters["straight"] = straight
+	world.Characters["diagonal"] = diagonal
+	world.Characters["spammed"] = spammed
+
+	move(t, gs, "straight", 1, 0)
+	move(t, gs, "diagonal", 5, 5)
+	for range 24 {
+		for range 10 {
+			move(t, gs, "spammed", 1, 0)
+		}
+		gs.UpdateWorld(1.0 / 60)
+	}
+
+	assert.InDelta(t, 120.0, distance(straight, 100, 100), 1e-9)
+	assert.InDelta(t, 120.0, distance(diagonal, 100, 300), 1e-9)
+	assert.InDelta(t, 120.0, distance(spammed, 100, 500), 1e-9)
+}
+
+func TestMovement_FrameRateIndependent(t *testing.T) {
+	world, gs := movingWorld(t)
+	fast := domain.NewMage("fast", 100, 100)
+	slow := domain.NewMage("slow", 100, 300)
+	world.Characters["fast"] = fast
+	move(t, gs, "fast", 0, 1)
+	for range 48 {
+		gs.UpdateWorld(1.0 / 120)
+	}
+	delete(world.Characters, "fast")
+	world.Characters["slow"] = slow
+	move(t, gs, "slow", 0, 1)
+	for range 12 {
+		gs.UpdateWorld(1.0 / 30)
+	}
+
+	assert.InDelta(t, distance(fast, 100, 100), distance(slow, 100, 300), 1e-9)
+}
+
+func TestMovement_ClampsAfterStepAndStopsWithoutInput(t *testing.T) {
+	world, gs := movingWorld(t)
+	w := domain.NewWarrior("w", 795, 400)
+	world.Characters["w"] = w
+
+	move(t, gs, "w", 1, 0)
+	gs.UpdateWorld(0.1)
+	x, _ := w.Position()
+	assert.Equal(t, 800.0, x)
+
+	move(t, gs, "w", -1, 0)
+	for range 60 {
+		gs.UpdateWorld(1.0 / 60)
+	}
+	stopped, _ := w.Position()
+	gs.UpdateWorld(0.1)
+	x, _ = w.Position()
+	assert.Equal(t, stopped, x)
+	assert.Equal(t, domain.StateIdle, w.State())
+
+	move(t, gs, "w", 0, 0)
+	assert.Equal(t, domain.StateIdle, w.State())
+}
@@ -0,0 +1,97 @@
+package application
+
+import (
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/prediction"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestPredictor_ReplaysUnacknowledgedInputs(t *testing.T) {
+	p := prediction.NewPredictor("w1", 800, 800)
+	p.Reconcile(services.WorldSnapshot{Characters: []services.CharacterSnapshot{
+		{ID: "w1", Class: "warrior", State: "idle", Health: 100, X: 100, Y: 100},
+	}})
+
+	p.Apply(prediction.Input{Seq: 1, DX: 1})
+	p.Advance(0.1)
+	p.Apply(prediction.Input{Seq: 2, DX: 1})
+	p.Advance(0.1)
+	p.Apply(prediction.Input{Seq: 3, DY: 1})
+	p.Advance(0.1)
+	x, y, _ := p.Position()
+	assert.InDelta(t, 160.0, x, 1e-9)
+	assert.InDelta(t, 130.0, y, 1e-9)
+
+	p.Reconcile(services.WorldSnapshot{LastInputSeq: 1, Characters: []services.CharacterSnapshot{
+		{ID: "w1", Class: "warrior", State: "running", Health: 100, X: 130, Y: 100},
+	}})
+	x, y, _ = p.Position()
+	assert.InDelta(t, 160.0, x, 1e-9)
+	assert.InDelta(t, 130.0, y, 1e-9)
+	assert.Equal(t, 2, p.Pending())
+}
+
+func TestPredictor_CorrectsToServerAndClamps(t *testing.T) {
+	p := prediction.NewPredictor("m1", 800, 800)
+	p.Apply(prediction.Input{Seq: 1, DX: 1})
+	p.Advance(0.1)
+	_, _, ok := p.Position()
+	assert.False(t, ok, "no position before the first snapshot")
+
+	p.Reconcile(services.WorldSnapshot{LastInputSeq: 1, Characters: []services.CharacterSnapshot{
+		{ID: "m1", Class: "mage", State: "idle", Health: 80, X: 40, Y: 40},
+	}})
+	p.Apply(prediction.Input{Seq: 2, DY: -1})
+	p.Advance(0.05)
+	x, y, ok := p.Position()
+	assert.True(t, ok)
+	assert.Equal(t, 40.0, x)
+	assert.InDelta(t, 19.0, y, 1e-9)
+
+	p.Advance(0.1)
+	_, y, _ = p.Position()
+	assert.Equal(t, 0.0, y)
+}
+
+// The server sees each input two frames late. As long as it simulates the
+// same inputs for the same time, reconciling must not move the character.
+func TestPredictor_AgreesWithLaggingServer(t *testing.T) {
+	const dt = 1.0 / 60
+	world := domain.NewWorld(800, 800)
+	world.Characters["w1"] = domain.NewWarrior("w1", 780, 400)
+	logger := new(MockLogger)
+	logger.On("LogEvent", mock.AnythingOfType("string")).Return()
+	gs := services.NewGameService(world, logger, services.NewWorldSnapshotService())
+	snapshot := func() services.WorldSnapshot {
+		ws := gs.BuildWorldSnapshot()
+		ws.LastInputSeq = ws.Characters[0].InputSeq
+		return ws
+	}
+
+	p := prediction.NewPredictor("w1", 800, 800)
+	p.Reconcile(snapshot())
+	dirs := [][2]float64{{1, 0}, {1, 1}, {1, 1}, {0, 1}, {-1, 0}, {-1, 0}, {0, 0}, {0, -1}, {1, -1}, {1, 0}}
+	var sent []command.DTO
+	for f, d := range dirs {
+		seq := uint64(f + 1)
+		p.Apply(prediction.Input{Seq: seq, DX: d[0], DY: d[1]})
+		p.Advance(dt)
+		sent = append(sent, command.DTO{Type: command.MOVE, CharacterID: "w1", Seq: seq, Data: map[string]interface{}{"dx": d[0], "dy": d[1]}})
+
+		if f >= 2 {
+			_ = gs.Enqueue(sent[f-2], nil)
+		}
+		gs.Tick(dt)
+		px, py, _ := p.Position()
+		p.Reconcile(snapshot())
+		rx, ry, _ := p.Position()
+		assert.InDelta(t, px, rx, 1e-9, "frame %d", f)
+		assert.InDelta(t, py, ry, 1e-9, "frame %d", f)
+	}
+	assert.Equal(t, 2, p.Pending())
+}
@@ -0,0 +1,96 @@
+package application
+
+import (
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSnapshots_ApplyRoundTrip(t *testing.T) {
+	base := services.WorldSnapshot{Characters: []services.CharacterSnapshot{
+		{ID: "a", Class: "mage", State: "idle", Health: 80, X: 1, Y: 1},
+		{ID: "b", Class: "warrior", State: "idle", Health: 100, X: 5, Y: 5},
+		{ID: "c", Class: "warrior", State: "idle", Health: 100, X: 9, Y: 9},
+	}}
+	cur := services.WorldSnapshot{Characters: []services.CharacterSnapshot{
+		{ID: "a", Class: "mage", State: "running", Health: 80, X: 3, Y: 1},
+		{ID: "b", Class: "warrior", State: "idle", Health: 100, X: 5, Y: 5},
+		{ID: "d", Class: "mage", State: "idle", Health: 80, X: 0, Y: 0},
+	}}
+
+	d := services.DiffSnapshots(base, cur)
+
+	assert.Equal(t, []string{"c"}, d.Removed)
+	assert.Len(t, d.Added, 1)
+	assert.Equal(t, "d", d.Added[0].ID)
+	assert.Len(t, d.Changed, 1)
+	assert.Equal(t, "a", d.Changed[0].ID)
+	assert.Nil(t, d.Changed[0].Health)
+	assert.Nil(t, d.Changed[0].Y)
+	assert.Equal(t, 3.0, *d.Changed[0].X)
+	assert.Equal(t, "running", *d.Changed[0].State)
+
+	assert.ElementsMatch(t, cur.Characters, services.ApplyDelta(base, d).Characters)
+	assert.Len(t, base.Characters, 3, "ApplyDelta must not modify the baseline")
+}
+
+func TestDiffSnapshots_CarriesHeader(t *testing.T) {
+	base := services.WorldSnapshot{Tick: 1, ServerTime: 100, LastInputSeq: 3}
+	cur := services.WorldSnapshot{Tick: 7, ServerTime: 700, LastInputSeq: 9}
+
+	got := services.ApplyDelta(base, services.DiffSnapshots(base, cur))
+
+	assert.Equal(t, uint64(7), got.Tick)
+	assert.Equal(t, int64(700), got.ServerTime)
+	assert.Equal(t, uint64(9), got.LastInputSeq)
+}
+
+func TestDiffSnapshots_Effects(t *testing.T) {
+	slow := []services.EffectSnapshot{{Kind: "slow", Magnitude: 0.5, Remaining: 2}}
+	base := services.WorldSnapshot{Characters: []services.CharacterSnapshot{{ID: "a", Effects: slow}, {ID: "b"}}}
+	cur := services.WorldSnapshot{Characters: []services.CharacterSnapshot{{ID: "a"}, {ID: "b", Effects: slow}}}
+
+	d := services.DiffSnapshots(base, cur)
+
+	assert.Len(t, d.Changed, 2)
+	assert.Empty(t, *d.Changed[0].Effects)
+	assert.Equal(t, slow, *d.Changed[1].Effects)
+	assert.Equal(t, cur.Characters, services.ApplyDelta(base, d).Characters)
+}
+
+func TestBuildSnapshot_IncludesEffects(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	war := domain.NewWarrior("w", 0, 0)
+	war.ApplyBurn(5, 3)
+	world.Characters["w"] = war
+
+	ws := services.NewWorldSnapshotService().BuildSnapshot(world)
+
+	assert.Equal(t, []services.EffectSnapshot{{Kind: "burn", Magnitude: 5, Remaining: 3}}, ws.Characters[0].Effects)
+}
+
+func TestBuildSnapshot_IncludesProjectiles(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	mage := domain.NewMage("m", 100, 100)
+	war := domain.NewWarrior("w", 400, 100)
+	world.Characters["m"] = mage
+	world.Characters["w"] = war
+	assert.NoError(t, mage.Cast(mage.Abilities()[0], war))
+	world.Update(0.01)
+
+	ws := services.NewWorldSnapshotService().BuildSnapshot(world)
+
+	if assert.Len(t, ws.Projectiles, 1) {
+		p := ws.Projectiles[0]
+		assert.Equal(t, "fireball", p.Kind)
+		assert.Equal(t, "m", p.Owner)
+		assert.InDelta(t, 106.0, p.X, 1e-9)
+		assert.InDelta(t, 600.0, p.VX, 1e-9)
+	}
+
+	d := services.DiffSnapshots(ws, ws)
+	assert.Equal(t, ws.Projectiles, d.Projectiles, "deltas carry the projectiles in full")
+	assert.Equal(t, ws.Projectiles, services.ApplyDelta(services.WorldSnapshot{}, d).Projectiles)
+}
@@ -0,0 +1,174 @@
+package domain_test
+
+import (
+	"errors"
+	"meatgrinder/internal/domain"
+	"testing"
+)
+
+func ability(c domain.Character, name string) domain.Ability {
+	for _, a := range c.Abilities() {
+		if a.Name == name {
+			return a
+		}
+	}
+	panic("no ability " + name)
+}
+
+func TestCast_CooldownAndEnergy(t *testing.T) {
+	war := domain.NewWarrior("w", 0, 0)
+	mage := domain.NewMage("m", 10, 0)
+	slash := ability(war, "slash")
+
+	if err := war.Cast(slash, mage); err != nil {
+		t.Fatal(err)
+	}
+	if err := war.Cast(slash, mage); !errors.Is(err, domain.ErrCasting) {
+		t.Errorf("second cast in the same tick: got %v, want ErrCasting", err)
+	}
+	war.Update(0.1)
+	war.CompletedCast()
+	if err := war.Cast(slash, mage); !errors.Is(err, domain.ErrOnCooldown) {
+		t.Errorf("cast during cooldown: got %v, want ErrOnCooldown", err)
+	}
+	if got := war.Cooldown("slash"); got <= 0 || got >= slash.Cooldown {
+		t.Errorf("cooldown = %.2f, want between 0 and %.2f", got, slash.Cooldown)
+	}
+
+	bash := ability(war, "shield_bash")
+	expensive := bash
+	expensive.Cost = 1000
+	if err := war.Cast(expensive, mage); !errors.Is(err, domain.ErrNoEnergy) {
+		t.Errorf("got %v, want ErrNoEnergy", err)
+	}
+	if err := war.Cast(bash, mage); err != nil {
+		t.Fatal(err)
+	}
+	if got := war.Energy(); got >= 100 {
+		t.Errorf("energy = %.1f, the cast should have cost some", got)
+	}
+}
+
+func TestCast_LandsAfterCastTime(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	mage := domain.NewMage("m", 0, 0)
+	war := domain.NewWarrior("w", 100, 0)
+	world.Characters["m"] = mage
+	world.Characters["w"] = war
+	frostbolt := ability(mage, "frostbolt")
+
+	if err := mage.Cast(frostbolt, war); err != nil {
+		t.Fatal(err)
+	}
+	if hits := world.Update(frostbolt.CastTime / 2); len(hits) != 0 {
+		t.Fatalf("landed before the cast time: %v", hits)
+	}
+	hits := world.Update(frostbolt.CastTime / 2)
+	if len(hits) != 1 || hits[0].Target != "w" || hits[0].Ability != "frostbolt" || hits[0].Damage <= 0 {
+		t.Fatalf("hits = %+v, want one frostbolt hit on w", hits)
+	}
+	if effects := war.Effects(); len(effects) != 1 || effects[0].Kind != domain.EffectSlow {
+		t.Errorf("effects = %v, want a slow", effects)
+	}
+}
+
+func TestCast_InterruptedAndDodged(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	mage := domain.NewMage("m", 0, 0)
+	war := domain.NewWarrior("w", 100, 0)
+	world.Characters["m"] = mage
+	world.Characters["w"] = war
+	frostbolt := ability(mage, "frostbolt")
+
+	_ = mage.Cast(frostbolt, war)
+	mage.ApplyStun(0.1)
+	if hits := world.Update(frostbolt.CastTime); len(hits) != 0 {
+		t.Errorf("a stun should interrupt the cast, got %v", hits)
+	}
+
+	world.Update(frostbolt.Cooldown)
+	_ = mage.Cast(frostbolt, war)
+	war.SetPosition(frostbolt.Range+50, 0)
+	if hits := world.Update(frostbolt.CastTime); len(hits) != 0 {
+		t.Errorf("a target that left the range should dodge, got %v", hits)
+	}
+}
+
+func TestCast_ConeHitsWhatTheCasterFaces(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	war := domain.NewWarrior("w", 400, 400)
+	world.Characters["w"] = war
+	front := domain.NewMage("front", 500, 420)
+	side := domain.NewMage("side", 440, 480)
+	behind := domain.NewMage("behind", 300, 400)
+	far := domain.NewMage("far", 700, 400)
+	for _, m := range []domain.Character{front, side, behind, far} {
+		world.Characters[m.ID()] = m
+	}
+
+	if err := war.CastAt(ability(war, "cleave"), 600, 400); err != nil {
+		t.Fatal(err)
+	}
+	if fx, fy := war.Facing(); fx != 1 || fy != 0 {
+		t.Errorf("facing = (%.2f, %.2f), want towards the aim point", fx, fy)
+	}
+	hits := world.Update(1.0 / 60)
+
+	got := map[string]bool{}
+	for _, h := range hits {
+		got[h.Target] = true
+	}
+	if len(hits) != 1 || !got["front"] {
+		t.Errorf("hit %v, want only front", got)
+	}
+}
+
+func TestCast_AreaHitsEveryoneAroundThePoint(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	mage := domain.NewMage("m", 100, 100)
+	world.Characters["m"] = mage
+	a := domain.NewWarrior("a", 400, 100)
+	b := domain.NewWarrior("b", 450, 180)
+	out := domain.NewWarrior("out", 600, 100)
+	for _, w := range []domain.Character{a, b, out} {
+		world.Characters[w.ID()] = w
+	}
+
+	blast := ability(mage, "blast")
+	if err := mage.CastAt(blast, 420, 120); err != nil {
+		t.Fatal(err)
+	}
+	var hits []domain.Hit
+	for i := 0; i < 60; i++ {
+		hits = append(hits, world.Update(1.0/60)...)
+	}
+
+	got := map[string]bool{}
+	for _, h := range hits {
+		got[h.Target] = true
+	}
+	if len(hits) != 2 || !got["a"] || !got["b"] {
+		t.Errorf("hit %v, want a and b", got)
+	}
+	if out.Health() != 100 {
+		t.Errorf("out of the blast took damage")
+	}
+}
+
+func TestFacing_FollowsMovementButNotDuringCasts(t *testing.T) {
+	mage := domain.NewMage("m", 100, 100)
+	if fx, fy := mage.Facing(); fx != 1 || fy != 0 {
+		t.Errorf("default facing = (%.2f, %.2f), want right", fx, fy)
+	}
+	mage.SetDirection(0, -1)
+	if fx, fy := mage.Facing(); fx != 0 || fy != -1 {
+		t.Errorf("facing = (%.2f, %.2f), want up", fx, fy)
+	}
+	if err := mage.CastAt(ability(mage, "blast"), 300, 100); err != nil {
+		t.Fatal(err)
+	}
+	mage.SetDirection(-1, 0)
+	if fx, fy := mage.Facing(); fx != 1 || fy != 0 {
+		t.Errorf("facing = (%.2f, %.2f), want the cast's direction while casting", fx, fy)
+	}
+}
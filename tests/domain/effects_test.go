@@ -0,0 +1,104 @@
+package domain_test
+
+import (
+	"math"
+	"meatgrinder/internal/domain"
+	"testing"
+)
+
+func speed(c domain.Character) float64 {
+	vx, vy := c.Velocity()
+	return math.Hypot(vx, vy)
+}
+
+func TestEffects_SlowAndHasteScaleSpeed(t *testing.T) {
+	war := domain.NewWarrior("w", 100, 100)
+	war.SetDirection(1, 0)
+	base := speed(war)
+
+	war.ApplySlow(0.5, 2.0)
+	if got := speed(war); got != base*0.5 {
+		t.Errorf("slowed speed = %.1f, want %.1f", got, base*0.5)
+	}
+	war.ApplyHaste(0.5, 1.0)
+	if got := speed(war); got != base*0.75 {
+		t.Errorf("slowed and hasted speed = %.1f, want %.1f", got, base*0.75)
+	}
+
+	war.Update(1.5)
+	war.SetDirection(1, 0)
+	if got := speed(war); got != base*0.5 {
+		t.Errorf("speed after haste expired = %.1f, want %.1f", got, base*0.5)
+	}
+	war.Update(1.0)
+	if len(war.Effects()) != 0 {
+		t.Errorf("effects left after expiry: %v", war.Effects())
+	}
+}
+
+func TestEffects_StacksAreCapped(t *testing.T) {
+	mage := domain.NewMage("m", 0, 0)
+	for i := 1; i <= 5; i++ {
+		mage.ApplySlow(0.1, float64(i))
+	}
+	effects := mage.Effects()
+	if len(effects) != 3 {
+		t.Fatalf("got %d slow stacks, want 3", len(effects))
+	}
+	for _, e := range effects {
+		if e.Remaining < 3 {
+			t.Errorf("a stack with %.0fs left survived; the shortest ones should be replaced", e.Remaining)
+		}
+	}
+}
+
+func TestEffects_StunStopsMovementAndAttacks(t *testing.T) {
+	war := domain.NewWarrior("w", 0, 0)
+	mage := domain.NewMage("m", 0, 0)
+	war.SetDirection(0, 1)
+	war.ApplyStun(1.0)
+
+	if speed(war) != 0 {
+		t.Error("a stunned character must not move")
+	}
+	war.Attack([]domain.Character{mage})
+	if mage.Health() != 80 {
+		t.Error("a stunned character must not attack")
+	}
+
+	war.Update(1.0)
+	war.SetDirection(0, 1)
+	if speed(war) == 0 {
+		t.Error("the stun should have worn off")
+	}
+}
+
+func TestEffects_BurnDealsDamageOverTime(t *testing.T) {
+	war := domain.NewWarrior("w", 0, 0)
+	war.ApplyBurn(10, 1.0)
+	war.ApplyBurn(10, 0.5)
+
+	for range 4 {
+		war.Update(0.5)
+	}
+	if got := war.Health(); math.Abs(got-85) > 1e-9 {
+		t.Errorf("health after burning = %.2f, want 85 (resistances do not apply)", got)
+	}
+}
+
+func TestBaseCharacter_MoveToStopsAtDestination(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	war := domain.NewWarrior("w", 0, 0)
+	world.Characters["w"] = war
+
+	war.MoveTo(10, 0)
+	world.Update(0.1)
+
+	x, y := war.Position()
+	if x != 10 || y != 0 {
+		t.Errorf("position = (%.1f, %.1f), want (10, 0)", x, y)
+	}
+	if speed(war) != 0 || war.State() != domain.StateIdle {
+		t.Error("the warrior should stop at its destination")
+	}
+}
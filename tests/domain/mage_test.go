@@ -8,15 +8,21 @@ import (
 func TestMage_Attack(t *testing.T) {
 	mage := domain.NewMage("mage1", 10, 10)
 	warr := domain.NewWarrior("war1", 10, 10)
+	other := domain.NewMage("mage2", 10, 10)
 
 	warrHealthBefore := warr.Health()
+	otherHealthBefore := other.Health()
 
-	mage.Attack([]domain.Character{warr})
+	mage.Attack([]domain.Character{warr, other})
 
 	if warr.Health() >= warrHealthBefore {
 		t.Errorf("Warrior's health should decrease after Mage attack. Before=%.1f, After=%.1f",
 			warrHealthBefore, warr.Health())
 	}
+	if other.Health() >= otherHealthBefore {
+		t.Errorf("Mage's health should decrease after Mage attack. Before=%.1f, After=%.1f",
+			otherHealthBefore, other.Health())
+	}
 }
 
 func TestMage_TakeDamage_MagicalRes(t *testing.T) {
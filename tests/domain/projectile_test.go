@@ -0,0 +1,85 @@
+package domain_test
+
+import (
+	"meatgrinder/internal/domain"
+	"testing"
+)
+
+// fly casts the mage's fireball at target and advances the world until the
+// projectile is gone, returning the hits it produced.
+func fly(t *testing.T, world *domain.World, mage, target domain.Character, beforeFlight func()) []domain.Hit {
+	t.Helper()
+	if err := mage.Cast(ability(mage, "fireball"), target); err != nil {
+		t.Fatal(err)
+	}
+	hits := world.Update(1.0 / 60)
+	if len(world.Projectiles) != 1 {
+		t.Fatalf("projectiles = %d, want 1 after the cast", len(world.Projectiles))
+	}
+	if beforeFlight != nil {
+		beforeFlight()
+	}
+	for i := 0; i < 120 && len(world.Projectiles) > 0; i++ {
+		hits = append(hits, world.Update(1.0/60)...)
+	}
+	if len(world.Projectiles) != 0 {
+		t.Fatal("projectile never expired")
+	}
+	return hits
+}
+
+func TestProjectile_HitsTargetInPath(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	mage := domain.NewMage("m", 100, 100)
+	war := domain.NewWarrior("w", 400, 100)
+	world.Characters["m"] = mage
+	world.Characters["w"] = war
+
+	hits := fly(t, world, mage, war, nil)
+
+	if len(hits) != 1 || hits[0].Target != "w" || hits[0].Caster != "m" {
+		t.Fatalf("hits = %+v, want one on w", hits)
+	}
+	if war.Health() >= 100 {
+		t.Errorf("health = %.1f, want damage", war.Health())
+	}
+	if mage.Health() != 80 {
+		t.Errorf("the fireball hit its owner")
+	}
+}
+
+func TestProjectile_MissesDodgingTarget(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	mage := domain.NewMage("m", 100, 100)
+	war := domain.NewWarrior("w", 400, 100)
+	world.Characters["m"] = mage
+	world.Characters["w"] = war
+
+	hits := fly(t, world, mage, war, func() { war.SetPosition(400, 200) })
+
+	if len(hits) != 0 {
+		t.Errorf("hits = %+v, want none after dodging", hits)
+	}
+	if war.Health() != 100 {
+		t.Errorf("health = %.1f, want untouched", war.Health())
+	}
+}
+
+func TestProjectile_HitsWhateverIsInTheWay(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	mage := domain.NewMage("m", 100, 100)
+	war := domain.NewWarrior("w", 400, 100)
+	blocker := domain.NewWarrior("b", 250, 110)
+	world.Characters["m"] = mage
+	world.Characters["w"] = war
+	world.Characters["b"] = blocker
+
+	hits := fly(t, world, mage, war, nil)
+
+	if len(hits) != 1 || hits[0].Target != "b" {
+		t.Fatalf("hits = %+v, want one on b", hits)
+	}
+	if war.Health() != 100 {
+		t.Errorf("target behind the blocker took damage")
+	}
+}
@@ -8,18 +8,24 @@ import (
 func TestWarrior_Attack(t *testing.T) {
 	war1 := domain.NewWarrior("w1", 0, 0)
 	mage := domain.NewMage("m1", 0, 0)
+	war2 := domain.NewWarrior("w2", 0, 0)
 
 	mageHPBefore := mage.Health()
-	war1.Attack([]domain.Character{mage})
+	war2HPBefore := war2.Health()
+	war1.Attack([]domain.Character{mage, war2})
 
 	if mage.Health() >= mageHPBefore {
 		t.Errorf("Mage's health must be lower after warrior's attack")
 	}
+	if war2.Health() >= war2HPBefore {
+		t.Errorf("Every target must be hit, not just the first")
+	}
 }
 
 func TestWarrior_ApplySlow(t *testing.T) {
 	war := domain.NewWarrior("w2", 0, 0)
-	warSpeedBefore := war.AttackPower()
+	war.SetDirection(1, 0)
+	warSpeedBefore := speed(war)
 
 	war.ApplySlow(0.5, 2.0)
 
@@ -28,7 +34,7 @@ func TestWarrior_ApplySlow(t *testing.T) {
 		t.Errorf("Warrior shouldn't be dead just from slow")
 	}
 
-	if warSpeedBefore == 0 {
-		t.Skip("Can't test speed. Implementation detail hidden.")
+	if got := speed(war); got >= warSpeedBefore {
+		t.Errorf("speed = %.1f after slow, want below %.1f", got, warSpeedBefore)
 	}
 }
@@ -0,0 +1,38 @@
+package infrastructure
+
+import (
+	"context"
+	"meatgrinder/internal/application/command"
+	"testing"
+	"time"
+)
+
+func TestServer_SendsOwnCooldownsAndEnergy(t *testing.T) {
+	addr, _ := startServer(t)
+
+	cl, snaps := snapshotClient(addr, "caster")
+	if err := cl.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	_ = cl.SendCommand(command.DTO{Type: command.SPAWN, CharacterID: "caster", Data: map[string]interface{}{}})
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case ws := <-snaps:
+			if len(ws.Abilities) == 0 {
+				continue
+			}
+			if len(ws.Abilities) != 3 {
+				t.Fatalf("got %d abilities, want the class's three", len(ws.Abilities))
+			}
+			if ws.Energy <= 0 {
+				t.Fatalf("energy = %.1f, want a full bar after spawning", ws.Energy)
+			}
+			return
+		case <-deadline:
+			t.Fatal("no snapshot carried the player's abilities")
+		}
+	}
+}
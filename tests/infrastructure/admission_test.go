@@ -0,0 +1,168 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startAdmissionServer(t *testing.T, configure func(*network.ServerConfig)) string {
+	t.Helper()
+	cfg := network.DefaultServerConfig("")
+	cfg.MaxPlayers = 1
+	cfg.ResumeGracePeriod = 0
+	cfg.HeartbeatInterval = 50 * time.Millisecond
+	if configure != nil {
+		configure(&cfg)
+	}
+	addr, _ := startServerWith(t, cfg, domain.NewWorld(800, 800))
+	return addr
+}
+
+func connect(t *testing.T, addr, id string, h network.ClientHandlers) (*network.Client, error) {
+	t.Helper()
+	cfg := network.DefaultClientConfig(addr)
+	cfg.CharacterID = id
+	cfg.Reconnect = false
+	cl := network.NewClient(cfg, h)
+	t.Cleanup(cl.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return cl, cl.Connect(ctx)
+}
+
+func waitForPosition(t *testing.T, positions <-chan int, want int) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case pos := <-positions:
+			if pos == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("never reached queue position %d", want)
+		}
+	}
+}
+
+func TestServer_QueuesJoinsWhenFull(t *testing.T) {
+	addr := startAdmissionServer(t, nil)
+
+	first, err := connect(t, addr, "first", network.ClientHandlers{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type joined struct {
+		id  string
+		err error
+	}
+	joins := make(chan joined, 2)
+	positions := make(map[string]chan int)
+	for i, id := range []string{"second", "third"} {
+		ch := make(chan int, 64)
+		positions[id] = ch
+		go func() {
+			_, err := connect(t, addr, id, network.ClientHandlers{
+				Queued: func(pos int) {
+					select {
+					case ch <- pos:
+					default:
+					}
+				},
+			})
+			joins <- joined{id, err}
+		}()
+		waitForPosition(t, ch, i+1)
+	}
+
+	first.Close()
+	select {
+	case j := <-joins:
+		if j.id != "second" || j.err != nil {
+			t.Fatalf("admitted %s (%v), want second", j.id, j.err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no one was admitted after a slot freed up")
+	}
+	waitForPosition(t, positions["third"], 1)
+	select {
+	case j := <-joins:
+		t.Fatalf("%s admitted while the room is full: %v", j.id, j.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServer_RejectsWhenQueueIsFull(t *testing.T) {
+	addr := startAdmissionServer(t, func(cfg *network.ServerConfig) { cfg.JoinQueueSize = 0 })
+
+	if _, err := connect(t, addr, "first", network.ClientHandlers{}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := connect(t, addr, "second", network.ClientHandlers{})
+	if !errors.Is(err, network.ErrHandshakeRejected) || !strings.Contains(err.Error(), "full") {
+		t.Fatalf("err = %v, want a full server rejection", err)
+	}
+}
+
+func TestServer_LimitsConnectionsPerAddress(t *testing.T) {
+	addr := startAdmissionServer(t, func(cfg *network.ServerConfig) {
+		cfg.MaxPlayers = 0
+		cfg.MaxConnsPerIP = 1
+	})
+
+	if _, err := connect(t, addr, "first", network.ClientHandlers{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connect(t, addr, "second", network.ClientHandlers{}); !errors.Is(err, network.ErrHandshakeRejected) {
+		t.Fatalf("err = %v, want the second connection from one address rejected", err)
+	}
+}
+
+func TestServer_AdmitsSpectatorsWhenFull(t *testing.T) {
+	addr := startAdmissionServer(t, func(cfg *network.ServerConfig) { cfg.AdmitSpectators = true })
+
+	player, snapshots := snapshotClient(addr, "player")
+	if err := player.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer player.Close()
+	_ = player.SendCommand(command.DTO{Type: command.SPAWN})
+	waitForCharacter(t, snapshots, "player")
+
+	watched := make(chan services.WorldSnapshot, 16)
+	results := make(chan network.CommandResult, 1)
+	spectator, err := connect(t, addr, "", network.ClientHandlers{
+		Snapshot: func(ws services.WorldSnapshot) {
+			select {
+			case watched <- ws:
+			default:
+			}
+		},
+		Result: func(r network.CommandResult) { results <- r },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spectator.Spectator() || spectator.CharacterID() != "" {
+		t.Fatalf("admitted as %q, want a spectator", spectator.CharacterID())
+	}
+	waitForCharacter(t, watched, "player")
+
+	_ = spectator.SendCommand(command.DTO{Type: command.SPAWN, RequestID: 1})
+	select {
+	case r := <-results:
+		if r.Code != string(services.CodeForbidden) {
+			t.Fatalf("spectator spawn result = %+v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no result for the spectator's command")
+	}
+}
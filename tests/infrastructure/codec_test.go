@@ -0,0 +1,186 @@
+package infrastructure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/infrastructure/network"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleSnapshot() network.ServerMessage {
+	health := 42.5
+	x := 10.0
+	flash := true
+	ping := 35
+	facing := -1.57
+	effects := []services.EffectSnapshot{}
+	return network.ServerMessage{Kind: network.ServerSnapshot, Snapshot: &network.SnapshotMessage{
+		Seq:      7,
+		Baseline: 5,
+		Delta: &services.SnapshotDelta{
+			Tick:         900,
+			ServerTime:   1700000000000000000,
+			LastInputSeq: 41,
+			Abilities:    []services.AbilityState{{Name: "fireball"}, {Name: "frostbolt", Cooldown: 2.25}},
+			Energy:       72.5,
+			Projectiles:  []services.ProjectileSnapshot{{ID: 3, Kind: "fireball", Owner: "m1", X: 100.5, Y: 40, VX: -600, VY: 12.25}},
+			Added: []services.CharacterSnapshot{{ID: "m1", Class: "mage", State: "idle", Health: 80, X: 1.25, Y: 799.5, Facing: 3.14, Ping: 120,
+				Effects: []services.EffectSnapshot{{Kind: "slow", Magnitude: 0.5, Remaining: 1.75}, {Kind: "stun", Remaining: 0.25}}}},
+			Removed:   []string{"w9"},
+			Changed:   []services.CharacterDelta{{ID: "w1", Health: &health, X: &x, Flash: &flash, Facing: &facing, Ping: &ping}, {ID: "w2", Effects: &effects}},
+			Despawned: []string{"w7"},
+		},
+	}}
+}
+
+func sampleServerMessages() []network.ServerMessage {
+	return []network.ServerMessage{
+		sampleSnapshot(),
+		{Kind: network.ServerEvent, Event: &services.GameEvent{Type: services.EventDied, Actor: "m1", Target: "w1"}},
+		{Kind: network.ServerResult, Result: &network.CommandResult{RequestID: 3, Code: "out_of_range", Message: "target is too far"}},
+		{Kind: network.ServerChat, Chat: &network.ChatMessage{From: "m1", Text: "gg"}},
+		{Kind: network.ServerNotice, Notice: &network.Notice{Level: network.NoticeWarning, Text: "restarting"}},
+		{Kind: network.ServerPing, Heartbeat: &network.Heartbeat{SentAt: 1700000000000000000}},
+		{Kind: network.ServerPong, Heartbeat: &network.Heartbeat{SentAt: 1700000000000000000, ReplyAt: 1700000000000500000}},
+	}
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	for _, codec := range []network.Codec{network.JSONCodec, network.BinaryCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			for _, m := range sampleServerMessages() {
+				b, err := codec.MarshalServer(m)
+				require.NoError(t, err)
+				buf.Write(b)
+			}
+			clientMessages := []network.ClientMessage{
+				{Kind: network.ClientCommand, Command: &command.DTO{
+					Type: command.MOVE,
+					Seq:  41,
+					Data: map[string]interface{}{"dx": 1.0, "dy": -1.0},
+				}},
+				{Kind: network.ClientAck, Ack: 12},
+				{Kind: network.ClientChat, Text: "hello"},
+				{Kind: network.ClientPing, Heartbeat: &network.Heartbeat{SentAt: 42}},
+				{Kind: network.ClientPong, Heartbeat: &network.Heartbeat{SentAt: 42, ReplyAt: -7}},
+			}
+			for _, m := range clientMessages {
+				b, err := codec.MarshalClient(m)
+				require.NoError(t, err)
+				buf.Write(b)
+			}
+
+			d := codec.NewDecoder(&buf)
+			for _, want := range sampleServerMessages() {
+				var got network.ServerMessage
+				require.NoError(t, d.DecodeServer(&got))
+				assert.Equal(t, want, got)
+			}
+			for _, want := range clientMessages {
+				var got network.ClientMessage
+				require.NoError(t, d.DecodeClient(&got))
+				assert.Equal(t, want, got)
+			}
+		})
+	}
+}
+
+func TestBinaryCodec_QuantizesAndShrinks(t *testing.T) {
+	full := &services.WorldSnapshot{}
+	for i := range 50 {
+		full.Characters = append(full.Characters, services.CharacterSnapshot{
+			ID: "player-0001", Class: "warrior", State: "running", Health: 73.3333, X: float64(i) * 13.37, Y: 400.01,
+		})
+	}
+	msg := network.ServerMessage{Kind: network.ServerSnapshot, Snapshot: &network.SnapshotMessage{Seq: 1, Full: full}}
+
+	jb, err := network.JSONCodec.MarshalServer(msg)
+	require.NoError(t, err)
+	bb, err := network.BinaryCodec.MarshalServer(msg)
+	require.NoError(t, err)
+	assert.Less(t, len(bb), len(jb)/2)
+
+	var got network.ServerMessage
+	require.NoError(t, network.BinaryCodec.NewDecoder(bytes.NewReader(bb)).DecodeServer(&got))
+	for i, c := range got.Snapshot.Full.Characters {
+		assert.InDelta(t, full.Characters[i].X, c.X, 1.0/16)
+		assert.InDelta(t, full.Characters[i].Health, c.Health, 1.0/10)
+	}
+}
+
+func TestBinaryCodec_RejectsOversizedFrameBeforeAllocating(t *testing.T) {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, network.MaxFrameSize+1)
+
+	var m network.ServerMessage
+	allocs := testing.AllocsPerRun(10, func() {
+		err := network.BinaryCodec.NewDecoder(bytes.NewReader(header)).DecodeServer(&m)
+		if !errors.Is(err, network.ErrFrameTooLarge) {
+			t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+		}
+	})
+	assert.Less(t, allocs, 5.0)
+}
+
+func TestJSONCodec_RejectsOversizedMessage(t *testing.T) {
+	huge := bytes.Repeat([]byte(" "), network.MaxFrameSize+1)
+	var m network.ClientMessage
+	err := network.JSONCodec.NewDecoder(bytes.NewReader(huge)).DecodeClient(&m)
+	assert.ErrorIs(t, err, network.ErrFrameTooLarge)
+}
+
+func fuzzSeeds(f *testing.F) {
+	for _, m := range sampleServerMessages() {
+		b, _ := network.BinaryCodec.MarshalServer(m)
+		f.Add(b)
+	}
+	cmd, _ := network.BinaryCodec.MarshalClient(network.ClientMessage{Kind: network.ClientCommand, Command: &command.DTO{
+		Type: command.ATTACK, Data: map[string]interface{}{"target_id": "w1"},
+	}})
+	ack, _ := network.BinaryCodec.MarshalClient(network.ClientMessage{Kind: network.ClientAck, Ack: 300})
+	f.Add(cmd)
+	f.Add(ack)
+	f.Add([]byte{0, 0, 0, 0})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{0, 0, 0, 3, 3, 0xff, 0xff})
+	f.Add([]byte{0, 0, 0, 6, 3, 1, 0, 1, 0xff, 0xff})
+}
+
+func FuzzBinaryCodec_DecodeServer(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m network.ServerMessage
+		if err := network.BinaryCodec.NewDecoder(bytes.NewReader(data)).DecodeServer(&m); err != nil {
+			return
+		}
+		// Anything that decodes must survive a round trip.
+		b, err := network.BinaryCodec.MarshalServer(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again network.ServerMessage
+		if err := network.BinaryCodec.NewDecoder(bytes.NewReader(b)).DecodeServer(&again); err != nil {
+			t.Fatalf("re-encoded frame failed to decode: %v", err)
+		}
+	})
+}
+
+func FuzzBinaryCodec_DecodeClient(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d := network.BinaryCodec.NewDecoder(bytes.NewReader(data))
+		for {
+			var m network.ClientMessage
+			if err := d.DecodeClient(&m); err != nil {
+				return
+			}
+		}
+	})
+}
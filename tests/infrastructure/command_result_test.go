@@ -0,0 +1,53 @@
+package infrastructure
+
+import (
+	"context"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/infrastructure/network"
+	"testing"
+	"time"
+)
+
+func TestServer_RepliesWithCommandResults(t *testing.T) {
+	addr, _ := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan network.CommandResult, 8)
+	cl := newClientWith(addr, "asker", network.ClientHandlers{
+		Result: func(r network.CommandResult) { results <- r },
+	})
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	await := func(id uint64) network.CommandResult {
+		t.Helper()
+		for {
+			select {
+			case r := <-results:
+				if r.RequestID == id {
+					return r
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatalf("no result for request %d", id)
+			}
+		}
+	}
+
+	spawnID, _ := cl.Request(command.DTO{Type: command.SPAWN})
+	if r := await(spawnID); !r.OK() {
+		t.Fatalf("spawn failed: %+v", r)
+	}
+
+	attackID, _ := cl.Request(command.DTO{Type: command.ATTACK, Data: map[string]interface{}{"target_id": "nobody"}})
+	if r := await(attackID); r.Code != string(services.CodeTargetNotFound) || r.Message == "" {
+		t.Fatalf("unexpected attack result: %+v", r)
+	}
+
+	spoofID, _ := cl.Request(command.DTO{Type: command.DISCONNECT, CharacterID: "someone-else"})
+	if r := await(spoofID); r.Code != string(services.CodeForbidden) {
+		t.Fatalf("unexpected spoof result: %+v", r)
+	}
+}
@@ -0,0 +1,67 @@
+package infrastructure
+
+import (
+	"context"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"testing"
+	"time"
+)
+
+func playCompressed(t *testing.T, codec string, compression []string) network.ServerStats {
+	t.Helper()
+	addr, srv := startServerWith(t, network.DefaultServerConfig(""), domain.NewWorld(800, 800))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	snapshots := make(chan services.WorldSnapshot, 16)
+	cfg := network.DefaultClientConfig(addr)
+	cfg.CharacterID = "squeezed"
+	cfg.Codecs = []string{codec}
+	cfg.Compression = compression
+	cl := network.NewClient(cfg, network.ClientHandlers{
+		Snapshot: func(ws services.WorldSnapshot) {
+			select {
+			case snapshots <- ws:
+			default:
+			}
+		},
+	})
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = cl.SendCommand(command.DTO{Type: command.SPAWN})
+	waitForCharacter(t, snapshots, "squeezed")
+
+	deadline := time.Now().Add(3 * time.Second)
+	for srv.Stats().RawBytesPerSecond == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no send rate reported")
+		}
+		_ = cl.SendCommand(command.DTO{Type: command.MOVE, Data: map[string]interface{}{"dx": 1.0, "dy": 0.0}})
+		time.Sleep(50 * time.Millisecond)
+	}
+	waitForCharacter(t, snapshots, "squeezed")
+	return srv.Stats()
+}
+
+func TestServer_CompressesNegotiatedStreams(t *testing.T) {
+	for _, codec := range []string{"json", "binary"} {
+		t.Run(codec, func(t *testing.T) {
+			st := playCompressed(t, codec, []string{network.CompressionDeflate})
+			if st.CompressedBytes >= st.RawBytes || st.CompressedBytesPerSecond >= st.RawBytesPerSecond {
+				t.Fatalf("compression did not shrink the stream: %+v", st)
+			}
+			t.Logf("%s: %.0f B/s raw, %.0f B/s compressed", codec, st.RawBytesPerSecond, st.CompressedBytesPerSecond)
+		})
+	}
+}
+
+func TestServer_SendsUncompressedWithoutNegotiation(t *testing.T) {
+	st := playCompressed(t, "json", nil)
+	if st.RawBytes == 0 || st.CompressedBytes != st.RawBytes {
+		t.Fatalf("raw %d bytes, compressed %d bytes, want equal", st.RawBytes, st.CompressedBytes)
+	}
+}
@@ -0,0 +1,102 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestHandshake_AssignsIdentity(t *testing.T) {
+	addr, _ := startServer(t)
+
+	cl := newClient(addr, "")
+	if err := cl.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	if cl.CharacterID() == "" {
+		t.Fatal("server should assign a character id")
+	}
+}
+
+func TestHandshake_RejectsDuplicateIdentity(t *testing.T) {
+	addr, _ := startServer(t)
+
+	first := newClient(addr, "hero")
+	if err := first.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	second := newClient(addr, "hero")
+	err := second.Connect(context.Background())
+	if !errors.Is(err, network.ErrHandshakeRejected) {
+		t.Fatalf("expected handshake rejection, got %v", err)
+	}
+}
+
+func TestHandshake_RejectsProtocolVersion(t *testing.T) {
+	addr, _ := startServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(network.Hello{Version: network.ProtocolVersion + 1}); err != nil {
+		t.Fatal(err)
+	}
+	var w network.Welcome
+	if err := json.NewDecoder(conn).Decode(&w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Error == "" {
+		t.Fatal("expected a rejection for a mismatched protocol version")
+	}
+}
+
+func TestServer_IgnoresCommandsForOtherCharacters(t *testing.T) {
+	addr, _ := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	victim, snapshots := snapshotClient(addr, "victim")
+	if err := victim.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = victim.SendCommand(command.DTO{Type: command.SPAWN})
+
+	attacker := newClient(addr, "attacker")
+	if err := attacker.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = attacker.SendCommand(command.DTO{Type: command.DISCONNECT, CharacterID: "victim"})
+
+	// Skip anything that might predate the spoofed command.
+	time.Sleep(100 * time.Millisecond)
+	for range 2 {
+		<-snapshots
+	}
+
+	if !containsCharacter(<-snapshots, "victim") {
+		t.Fatal("victim was removed by a command sent from another connection")
+	}
+}
+
+func containsCharacter(ws services.WorldSnapshot, id string) bool {
+	for _, c := range ws.Characters {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
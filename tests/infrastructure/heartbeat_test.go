@@ -0,0 +1,123 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"testing"
+	"time"
+)
+
+// dialJSON performs a JSON handshake on a raw connection.
+func dialJSON(t *testing.T, addr, id string) (net.Conn, *json.Encoder, *json.Decoder) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	if err := enc.Encode(network.Hello{Version: network.ProtocolVersion, CharacterID: id}); err != nil {
+		t.Fatal(err)
+	}
+	var w network.Welcome
+	if err := dec.Decode(&w); err != nil || w.Error != "" {
+		t.Fatalf("handshake failed: %v %s", err, w.Error)
+	}
+	return conn, enc, dec
+}
+
+func TestServer_DisconnectsIdlePeer(t *testing.T) {
+	cfg := network.DefaultServerConfig("")
+	cfg.HeartbeatInterval = 50 * time.Millisecond
+	cfg.IdleTimeout = 200 * time.Millisecond
+	addr, srv := startServerWith(t, cfg, domain.NewWorld(800, 800))
+
+	_, _, dec := dialJSON(t, addr, "silent")
+	start := time.Now()
+	pings := 0
+	for {
+		var m network.ServerMessage
+		if err := dec.Decode(&m); err != nil {
+			break
+		}
+		if m.Kind == network.ServerPing {
+			pings++
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("idle peer was kept for %v", elapsed)
+	}
+	if pings == 0 {
+		t.Fatal("server never pinged the peer")
+	}
+	if got := srv.Stats().IdleTimeouts; got != 1 {
+		t.Fatalf("IdleTimeouts = %d, want 1", got)
+	}
+}
+
+func TestServer_ReportsPingInSnapshots(t *testing.T) {
+	cfg := network.DefaultServerConfig("")
+	cfg.HeartbeatInterval = 20 * time.Millisecond
+	addr, _ := startServerWith(t, cfg, domain.NewWorld(800, 800))
+
+	_, enc, dec := dialJSON(t, addr, "laggy")
+	if err := enc.Encode(network.ClientMessage{Kind: network.ClientCommand, Command: &command.DTO{Type: command.SPAWN}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pretend every ping took 200ms to come back.
+	const lag = 200 * time.Millisecond
+	for {
+		var m network.ServerMessage
+		if err := dec.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		switch m.Kind {
+		case network.ServerPing:
+			h := network.Heartbeat{SentAt: m.Heartbeat.SentAt - int64(lag), ReplyAt: time.Now().UnixNano()}
+			if err := enc.Encode(network.ClientMessage{Kind: network.ClientPong, Heartbeat: &h}); err != nil {
+				t.Fatal(err)
+			}
+		case network.ServerSnapshot:
+			if m.Snapshot.Full == nil {
+				continue
+			}
+			for _, c := range m.Snapshot.Full.Characters {
+				if c.ID == "laggy" && c.Ping >= 150 {
+					return
+				}
+			}
+		}
+	}
+}
+
+func TestClient_MeasuresLatency(t *testing.T) {
+	addr, _ := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := network.DefaultClientConfig(addr)
+	cfg.HeartbeatInterval = 10 * time.Millisecond
+	cl := network.NewClient(cfg, network.ClientHandlers{})
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for cl.Latency().RTT == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client never measured a round trip")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if off := cl.Latency().ClockOffset; off > 50*time.Millisecond || off < -50*time.Millisecond {
+		t.Fatalf("clock offset against a local server = %v", off)
+	}
+}
@@ -0,0 +1,47 @@
+package infrastructure
+
+import (
+	"context"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"testing"
+	"time"
+)
+
+func TestServer_AcknowledgesLastProcessedInput(t *testing.T) {
+	addr, _ := startServer(t)
+
+	cl, snaps := snapshotClient(addr, "seq")
+	if err := cl.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	_ = cl.SendCommand(command.DTO{Type: command.SPAWN, CharacterID: "seq", Data: map[string]interface{}{}})
+	for range 4 {
+		_ = cl.SendCommand(command.DTO{Type: command.MOVE, CharacterID: "seq", Data: map[string]interface{}{"dx": 1.0, "dy": 0.0}})
+	}
+
+	var last services.WorldSnapshot
+	deadline := time.After(5 * time.Second)
+	for last.LastInputSeq < 5 {
+		select {
+		case ws := <-snaps:
+			if ws.Tick < last.Tick {
+				t.Fatalf("tick went backwards: %d after %d", ws.Tick, last.Tick)
+			}
+			if ws.LastInputSeq < last.LastInputSeq {
+				t.Fatalf("last input went backwards: %d after %d", ws.LastInputSeq, last.LastInputSeq)
+			}
+			if ws.ServerTime == 0 {
+				t.Fatal("snapshot without server time")
+			}
+			last = ws
+		case <-deadline:
+			t.Fatalf("last input seq = %d, want 5", last.LastInputSeq)
+		}
+	}
+	if last.LastInputSeq != 5 {
+		t.Fatalf("last input seq = %d, want 5", last.LastInputSeq)
+	}
+}
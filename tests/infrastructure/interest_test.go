@@ -0,0 +1,35 @@
+package infrastructure
+
+import (
+	"context"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"testing"
+)
+
+func TestServer_FiltersSnapshotsByInterest(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	world.Characters["npc-1"] = domain.NewWarrior("npc-1", 700, 700)
+	world.Characters["npc-2"] = domain.NewWarrior("npc-2", 5, 795)
+	cfg := network.DefaultServerConfig("")
+	cfg.InterestRadius = 1
+	addr, _ := startServerWith(t, cfg, world)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cl, snapshots := snapshotClient(addr, "scout")
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ws := <-snapshots; len(ws.Characters) != 2 {
+		t.Fatalf("before spawning the client should see the whole world, got %d characters", len(ws.Characters))
+	}
+
+	_ = cl.SendCommand(command.DTO{Type: command.SPAWN})
+	waitForCharacter(t, snapshots, "scout")
+	ws := <-snapshots
+	if len(ws.Characters) != 1 || ws.Characters[0].ID != "scout" {
+		t.Fatalf("snapshot outside the interest radius: %+v", ws.Characters)
+	}
+}
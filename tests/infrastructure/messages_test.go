@@ -0,0 +1,96 @@
+package infrastructure
+
+import (
+	"context"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/infrastructure/network"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestClient_ReceivesTypedMessages(t *testing.T) {
+	addr, srv := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan services.GameEvent, 16)
+	chats := make(chan network.ChatMessage, 16)
+	notices := make(chan network.Notice, 16)
+	listener := newClientWith(addr, "listener", network.ClientHandlers{
+		Event:  func(e services.GameEvent) { events <- e },
+		Chat:   func(m network.ChatMessage) { chats <- m },
+		Notice: func(n network.Notice) { notices <- n },
+	})
+	if err := listener.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	talker := newClient(addr, "talker")
+	if err := talker.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = talker.SendCommand(command.DTO{Type: command.SPAWN})
+	_ = talker.SendChat("  hello there  ")
+
+	timeout := time.After(3 * time.Second)
+	for gotEvent, gotChat := false, false; !gotEvent || !gotChat; {
+		select {
+		case e := <-events:
+			if e.Type == services.EventSpawned && e.Actor == "talker" {
+				gotEvent = true
+			}
+		case m := <-chats:
+			if m.From != "talker" || m.Text != "hello there" {
+				t.Fatalf("unexpected chat %+v", m)
+			}
+			gotChat = true
+		case <-timeout:
+			t.Fatalf("missing messages: event=%v chat=%v", gotEvent, gotChat)
+		}
+	}
+
+	srv.Notify(network.NoticeWarning, "maintenance soon")
+	select {
+	case n := <-notices:
+		if n.Level != network.NoticeWarning || n.Text != "maintenance soon" {
+			t.Fatalf("unexpected notice %+v", n)
+		}
+	case <-timeout:
+		t.Fatal("notice never arrived")
+	}
+}
+
+func TestServer_TruncatesChatOnRuneBoundary(t *testing.T) {
+	addr, _ := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chats := make(chan network.ChatMessage, 16)
+	listener := newClientWith(addr, "listener", network.ClientHandlers{
+		Chat: func(m network.ChatMessage) { chats <- m },
+	})
+	if err := listener.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	talker := newClient(addr, "talker")
+	if err := talker.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// The 256-byte limit falls in the middle of the "é".
+	_ = talker.SendChat(strings.Repeat("a", 255) + "é and more")
+
+	select {
+	case m := <-chats:
+		if m.Text != strings.Repeat("a", 255) {
+			t.Fatalf("chat = %q, want it cut before the split rune", m.Text)
+		}
+		if !utf8.ValidString(m.Text) {
+			t.Fatal("chat is not valid UTF-8")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("chat never arrived")
+	}
+}
@@ -0,0 +1,111 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer_EscalatesAgainstCommandFlood(t *testing.T) {
+	cfg := network.DefaultServerConfig("")
+	cfg.CommandRates = map[command.Type]network.RateLimit{command.MOVE: {Rate: 0.001, Burst: 5}}
+	cfg.FloodWarnAfter = 3
+	cfg.FloodKickAfter = 10
+	addr, srv := startServerWith(t, cfg, domain.NewWorld(800, 800))
+
+	_, enc, dec := dialJSON(t, addr, "flooder")
+	for i := 1; i <= 30; i++ {
+		move := command.DTO{Type: command.MOVE, RequestID: uint64(i), Data: map[string]interface{}{"dx": 1.0, "dy": 0.0}}
+		if err := enc.Encode(network.ClientMessage{Kind: network.ClientCommand, Command: &move}); err != nil {
+			break
+		}
+	}
+
+	limited := 0
+	var notices []network.NoticeLevel
+	for {
+		var m network.ServerMessage
+		if err := dec.Decode(&m); err != nil {
+			break
+		}
+		switch m.Kind {
+		case network.ServerResult:
+			if m.Result.Code == string(services.CodeRateLimited) {
+				limited++
+			}
+		case network.ServerNotice:
+			notices = append(notices, m.Notice.Level)
+		}
+	}
+
+	if limited != 9 {
+		t.Errorf("got %d rate limited results, want 9", limited)
+	}
+	if len(notices) != 2 || notices[0] != network.NoticeWarning || notices[1] != network.NoticeKick {
+		t.Errorf("notices = %v, want a warning then a kick", notices)
+	}
+	st := srv.Stats()
+	if st.CommandsRateLimited != 10 || st.FloodWarnings != 1 || st.FloodKicks != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestServer_DisconnectsOversizedMessage(t *testing.T) {
+	cfg := network.DefaultServerConfig("")
+	cfg.MaxMessageSize = 256
+	addr, srv := startServerWith(t, cfg, domain.NewWorld(800, 800))
+
+	_, enc, dec := dialJSON(t, addr, "spammer")
+	if err := enc.Encode(network.ClientMessage{Kind: network.ClientChat, Text: strings.Repeat("a", 1000)}); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var m json.RawMessage
+		if err := dec.Decode(&m); err != nil {
+			break
+		}
+	}
+	if got := srv.Stats().OversizedMessages; got != 1 {
+		t.Fatalf("OversizedMessages = %d, want 1", got)
+	}
+}
+
+func TestServer_LimitsChat(t *testing.T) {
+	cfg := network.DefaultServerConfig("")
+	cfg.ChatRate = network.RateLimit{Rate: 0.001, Burst: 5}
+	addr, srv := startServerWith(t, cfg, domain.NewWorld(800, 800))
+
+	conn, enc, dec := dialJSON(t, addr, "chatty")
+	for i := 0; i < 20; i++ {
+		if err := enc.Encode(network.ClientMessage{Kind: network.ClientChat, Text: "spam"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for srv.Stats().ChatRateLimited < 15 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := srv.Stats().ChatRateLimited; got != 15 {
+		t.Fatalf("ChatRateLimited = %d, want 15", got)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	chats := 0
+	for {
+		var m network.ServerMessage
+		if err := dec.Decode(&m); err != nil {
+			break
+		}
+		if m.Kind == network.ServerChat {
+			chats++
+		}
+	}
+	if chats != 5 {
+		t.Errorf("got %d chats back, want the burst of 5", chats)
+	}
+}
@@ -0,0 +1,183 @@
+package infrastructure
+
+import (
+	"context"
+	"io"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cutProxy forwards TCP connections to a backend and can sever all of them
+// at once, simulating a network drop the server did not initiate.
+type cutProxy struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newCutProxy(t *testing.T, backend string) *cutProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &cutProxy{ln: ln}
+	t.Cleanup(func() {
+		_ = ln.Close()
+		p.cut()
+	})
+	go func() {
+		for {
+			in, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			out, err := net.Dial("tcp", backend)
+			if err != nil {
+				_ = in.Close()
+				continue
+			}
+			p.mu.Lock()
+			p.conns = append(p.conns, in, out)
+			p.mu.Unlock()
+			go func() { _, _ = io.Copy(out, in); _ = out.Close() }()
+			go func() { _, _ = io.Copy(in, out); _ = in.Close() }()
+		}
+	}()
+	return p
+}
+
+func (p *cutProxy) addr() string {
+	return p.ln.Addr().String()
+}
+
+func (p *cutProxy) cut() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		_ = c.Close()
+	}
+	p.conns = nil
+}
+
+func findCharacter(ws services.WorldSnapshot, id string) (services.CharacterSnapshot, bool) {
+	for _, c := range ws.Characters {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return services.CharacterSnapshot{}, false
+}
+
+func waitForCharacter(t *testing.T, snapshots <-chan services.WorldSnapshot, id string) services.CharacterSnapshot {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ws := <-snapshots:
+			if c, ok := findCharacter(ws, id); ok {
+				return c
+			}
+		case <-timeout:
+			t.Fatalf("%s never appeared in a snapshot", id)
+		}
+	}
+}
+
+func TestClient_ResumesSessionAfterDrop(t *testing.T) {
+	addr, _ := startServer(t)
+	proxy := newCutProxy(t, addr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	snapshots := make(chan services.WorldSnapshot, 16)
+	reconnected := make(chan bool, 1)
+	cl := newClientWith(proxy.addr(), "wanderer", network.ClientHandlers{
+		Snapshot: func(ws services.WorldSnapshot) {
+			select {
+			case snapshots <- ws:
+			default:
+			}
+		},
+		Reconnect: func(resumed bool) { reconnected <- resumed },
+	})
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = cl.SendCommand(command.DTO{Type: command.SPAWN})
+	before := waitForCharacter(t, snapshots, "wanderer")
+
+	proxy.cut()
+
+	select {
+	case resumed := <-reconnected:
+		if !resumed {
+			t.Fatal("expected the session to be resumed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("client did not reconnect")
+	}
+	if cl.CharacterID() != "wanderer" {
+		t.Fatalf("character id changed to %q", cl.CharacterID())
+	}
+
+	after := waitForCharacter(t, snapshots, "wanderer")
+	if after.X != before.X || after.Y != before.Y || after.Health != before.Health {
+		t.Fatalf("character changed across the resume: %+v -> %+v", before, after)
+	}
+}
+
+func TestServer_RemovesCharacterAfterGracePeriod(t *testing.T) {
+	cfg := network.DefaultServerConfig("")
+	cfg.ResumeGracePeriod = 300 * time.Millisecond
+	addr, _ := startServerWith(t, cfg, domain.NewWorld(800, 800))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leaver := newClient(addr, "leaver")
+	if err := leaver.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = leaver.SendCommand(command.DTO{Type: command.SPAWN})
+
+	watcher, snapshots := snapshotClient(addr, "watcher")
+	if err := watcher.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitForCharacter(t, snapshots, "leaver")
+
+	leaver.Close()
+	time.Sleep(50 * time.Millisecond)
+	drain(snapshots)
+	if !containsCharacter(<-snapshots, "leaver") {
+		t.Fatal("character was removed before the grace period ended")
+	}
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ws := <-snapshots:
+			if !containsCharacter(ws, "leaver") {
+				return
+			}
+		case <-timeout:
+			t.Fatal("character was not removed after the grace period")
+		}
+	}
+}
+
+func drain(snapshots <-chan services.WorldSnapshot) {
+	for {
+		select {
+		case <-snapshots:
+		default:
+			return
+		}
+	}
+}
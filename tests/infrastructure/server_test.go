@@ -0,0 +1,145 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type nopLogger struct{}
+
+func (nopLogger) LogEvent(string) {}
+
+func startServer(t *testing.T) (string, *network.Server) {
+	t.Helper()
+	return startServerWith(t, network.DefaultServerConfig(""), domain.NewWorld(800, 800))
+}
+
+func startServerWith(t *testing.T, cfg network.ServerConfig, world *domain.World) (string, *network.Server) {
+	t.Helper()
+	gs := services.NewGameService(world, nopLogger{}, services.NewWorldSnapshotService())
+	srv := network.NewServer(cfg, gs)
+	loop := services.NewGameLoop(gs, srv, 120, 20)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{}, 2)
+	go func() {
+		_ = srv.Serve(ctx, ln)
+		done <- struct{}{}
+	}()
+	go func() {
+		loop.Run(ctx)
+		done <- struct{}{}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		_ = ln.Close()
+		<-done
+		<-done
+	})
+	return ln.Addr().String(), srv
+}
+
+func newClient(addr, id string) *network.Client {
+	return newClientWith(addr, id, network.ClientHandlers{})
+}
+
+func newClientWith(addr, id string, h network.ClientHandlers) *network.Client {
+	cfg := network.DefaultClientConfig(addr)
+	cfg.CharacterID = id
+	return network.NewClient(cfg, h)
+}
+
+// snapshotClient returns a client whose snapshots are delivered on a
+// channel. Snapshots are dropped rather than blocking the reader when the
+// test falls behind.
+func snapshotClient(addr, id string) (*network.Client, <-chan services.WorldSnapshot) {
+	ch := make(chan services.WorldSnapshot, 16)
+	cl := newClientWith(addr, id, network.ClientHandlers{
+		Snapshot: func(ws services.WorldSnapshot) {
+			select {
+			case ch <- ws:
+			default:
+			}
+		},
+	})
+	return cl, ch
+}
+
+// Run with -race: many clients spawn, move, attack and disconnect while the
+// game loop ticks and broadcasts snapshots.
+func TestServer_ConcurrentClients(t *testing.T) {
+	addr, _ := startServer(t)
+
+	const clients = 16
+	ids := make([]string, clients)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("player-%d", i)
+	}
+
+	var wg sync.WaitGroup
+	snapshots := make([]int, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			received := make(chan struct{})
+			cl := newClientWith(addr, ids[i], network.ClientHandlers{
+				Snapshot: func(services.WorldSnapshot) { snapshots[i]++ },
+			})
+			if err := cl.Connect(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+			go func() {
+				defer close(received)
+				<-cl.Done()
+			}()
+
+			id := ids[i]
+			_ = cl.SendCommand(command.DTO{Type: command.SPAWN, CharacterID: id, Data: map[string]interface{}{}})
+			r := rand.New(rand.NewSource(int64(i)))
+			deadline := time.Now().Add(500 * time.Millisecond)
+			for time.Now().Before(deadline) {
+				if r.Intn(4) == 0 {
+					_ = cl.SendCommand(command.DTO{
+						Type:        command.ATTACK,
+						CharacterID: id,
+						Data:        map[string]interface{}{"target_id": ids[r.Intn(clients)]},
+					})
+				} else {
+					_ = cl.SendCommand(command.DTO{
+						Type:        command.MOVE,
+						CharacterID: id,
+						Data:        map[string]interface{}{"dx": r.Float64()*2 - 1, "dy": r.Float64()*2 - 1},
+					})
+				}
+				time.Sleep(time.Millisecond)
+			}
+			cl.Close()
+			<-received
+		}(i)
+	}
+	wg.Wait()
+
+	for i, n := range snapshots {
+		if n == 0 {
+			t.Errorf("client %d received no snapshots", i)
+		}
+	}
+}
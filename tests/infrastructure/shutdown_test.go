@@ -0,0 +1,79 @@
+package infrastructure
+
+import (
+	"context"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_CancelUnblocksAccept(t *testing.T) {
+	gs := services.NewGameService(domain.NewWorld(800, 800), nopLogger{}, services.NewWorldSnapshotService())
+	srv := network.NewServer(network.DefaultServerConfig(""), gs)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ctx, ln) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("Serve returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve is still blocked in Accept after cancel")
+	}
+}
+
+func TestServer_ShutdownNotifiesAndDrains(t *testing.T) {
+	addr, srv := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notices := make(chan network.Notice, 4)
+	cfg := network.DefaultClientConfig(addr)
+	cfg.CharacterID = "stayer"
+	cfg.Reconnect = false
+	cl := network.NewClient(cfg, network.ClientHandlers{
+		Notice: func(n network.Notice) { notices <- n },
+	})
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sctx, scancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer scancel()
+	if err := srv.Shutdown(sctx, "maintenance"); err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+
+	select {
+	case n := <-notices:
+		if n.Level != network.NoticeShutdown || n.Text != "maintenance" {
+			t.Fatalf("unexpected notice %+v", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no shutdown notice before the connection closed")
+	}
+	select {
+	case <-cl.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection stayed open after shutdown")
+	}
+
+	late := newClient(addr, "late")
+	if err := late.Connect(ctx); err == nil {
+		late.Close()
+		t.Fatal("server accepted a connection after shutdown")
+	}
+}
@@ -0,0 +1,56 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_EvictsSlowConsumer(t *testing.T) {
+	world := domain.NewWorld(800, 800)
+	for i := range 2000 {
+		world.SpawnRandomCharacter(fmt.Sprintf("npc-%d", i))
+	}
+	cfg := network.DefaultServerConfig("")
+	cfg.WriteTimeout = 200 * time.Millisecond
+	cfg.MaxCoalescedSnapshots = 3
+	addr, srv := startServerWith(t, cfg, world)
+
+	// A client that completes the handshake and then never reads.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.(*net.TCPConn).SetReadBuffer(4096)
+	if err := json.NewEncoder(conn).Encode(network.Hello{Version: network.ProtocolVersion, CharacterID: "stalled"}); err != nil {
+		t.Fatal(err)
+	}
+
+	healthy, snapshots := snapshotClient(addr, "healthy")
+	if err := healthy.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer healthy.Close()
+
+	deadline := time.After(10 * time.Second)
+	poll := time.NewTicker(10 * time.Millisecond)
+	defer poll.Stop()
+	for {
+		select {
+		case <-snapshots:
+		case <-poll.C:
+		case <-deadline:
+			t.Fatalf("stalled client was never dropped: %+v", srv.Stats())
+		}
+		st := srv.Stats()
+		if st.SlowConsumersEvicted > 0 || st.WriteErrors > 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"encoding/json"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServer_SendsDeltasAgainstAckedBaseline(t *testing.T) {
+	addr, _ := startServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+
+	if err := enc.Encode(network.Hello{Version: network.ProtocolVersion, CharacterID: "acker"}); err != nil {
+		t.Fatal(err)
+	}
+	var w network.Welcome
+	if err := dec.Decode(&w); err != nil || w.Error != "" {
+		t.Fatalf("handshake failed: %v %s", err, w.Error)
+	}
+
+	read := func() network.SnapshotMessage {
+		t.Helper()
+		for {
+			var m network.ServerMessage
+			if err := dec.Decode(&m); err != nil {
+				t.Fatal(err)
+			}
+			if m.Kind == network.ServerSnapshot {
+				return *m.Snapshot
+			}
+		}
+	}
+	ack := func(seq uint64) {
+		t.Helper()
+		if err := enc.Encode(network.ClientMessage{Kind: network.ClientAck, Ack: seq}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := read()
+	if first.Full == nil {
+		t.Fatal("first snapshot must be full")
+	}
+	ack(first.Seq)
+
+	var delta network.SnapshotMessage
+	for delta = read(); delta.Delta == nil; delta = read() {
+	}
+	if delta.Baseline != first.Seq {
+		t.Fatalf("delta baseline = %d, want %d", delta.Baseline, first.Seq)
+	}
+
+	ack(0)
+	var full network.SnapshotMessage
+	for full = read(); full.Full == nil; full = read() {
+		if full.Seq > delta.Seq+5 {
+			t.Fatal("server kept sending deltas after the baseline was reset")
+		}
+	}
+}
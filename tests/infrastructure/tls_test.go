@@ -0,0 +1,142 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert generates a throwaway certificate for 127.0.0.1 and
+// returns the paths of its PEM certificate and key.
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "meatgrinder test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func startTLSServer(t *testing.T) (addr string, srv *network.Server, certFile string) {
+	t.Helper()
+	certFile, keyFile := writeSelfSignedCert(t)
+	cfg := network.DefaultServerConfig("")
+	cfg.TLSCertFile, cfg.TLSKeyFile = certFile, keyFile
+	addr, srv = startServerWith(t, cfg, domain.NewWorld(800, 800))
+	return addr, srv, certFile
+}
+
+func TestTLS_ClientWithPinnedCertPlays(t *testing.T) {
+	addr, srv, certFile := startTLSServer(t)
+	wsURL := startWebSocket(t, srv)
+
+	for name, target := range map[string]string{
+		"tcp":       "tls://" + addr,
+		"websocket": strings.Replace(wsURL, "ws://", "wss://", 1),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			snapshots := make(chan services.WorldSnapshot, 16)
+			cfg := network.DefaultClientConfig(target)
+			cfg.CharacterID = "secret-" + name
+			cfg.TLSPinnedCert = certFile
+			cl := network.NewClient(cfg, network.ClientHandlers{
+				Snapshot: func(ws services.WorldSnapshot) {
+					select {
+					case snapshots <- ws:
+					default:
+					}
+				},
+			})
+			if err := cl.Connect(ctx); err != nil {
+				t.Fatal(err)
+			}
+			_ = cl.SendCommand(command.DTO{Type: command.SPAWN})
+			waitForCharacter(t, snapshots, cfg.CharacterID)
+		})
+	}
+}
+
+func TestTLS_RejectsUnpinnedCertificate(t *testing.T) {
+	addr, _, _ := startTLSServer(t)
+	otherCert, _ := writeSelfSignedCert(t)
+
+	cfg := network.DefaultClientConfig("tls://" + addr)
+	cfg.TLSPinnedCert = otherCert
+	if err := network.NewClient(cfg, network.ClientHandlers{}).Connect(context.Background()); err == nil {
+		t.Fatal("connected to a server presenting a different certificate")
+	}
+
+	cfg.TLSPinnedCert = ""
+	if err := network.NewClient(cfg, network.ClientHandlers{}).Connect(context.Background()); err == nil {
+		t.Fatal("a self-signed certificate passed verification against the system roots")
+	}
+}
+
+func TestTLS_ServerRefusesPlaintext(t *testing.T) {
+	addr, _, _ := startTLSServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := network.NewClient(network.DefaultClientConfig(addr), network.ClientHandlers{}).Connect(ctx); err == nil {
+		t.Fatal("plaintext client completed the handshake with a TLS server")
+	}
+}
+
+func TestTLS_ServerRefusesUDP(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t)
+	cfg := network.DefaultServerConfig("")
+	cfg.TLSCertFile, cfg.TLSKeyFile = certFile, keyFile
+	srv := network.NewServer(cfg, services.NewGameService(domain.NewWorld(800, 800), nopLogger{}, services.NewWorldSnapshotService()))
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.ServeUDP(context.Background(), pc); !errors.Is(err, network.ErrUDPWithTLS) {
+		t.Fatalf("ServeUDP = %v, want ErrUDPWithTLS", err)
+	}
+}
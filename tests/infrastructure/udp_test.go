@@ -0,0 +1,270 @@
+package infrastructure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/domain"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lossyPacketConn drops a fraction of datagrams in both directions.
+type lossyPacketConn struct {
+	net.PacketConn
+	mu   sync.Mutex
+	rng  *rand.Rand
+	loss float64
+}
+
+func (c *lossyPacketConn) drop() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.Float64() < c.loss
+}
+
+func (c *lossyPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(b)
+		if err != nil || !c.drop() {
+			return n, addr, err
+		}
+	}
+}
+
+func (c *lossyPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.drop() {
+		return len(b), nil
+	}
+	return c.PacketConn.WriteTo(b, addr)
+}
+
+// startUDP serves srv over UDP, losing the given fraction of packets each
+// way, and returns the client address.
+func startUDP(t *testing.T, srv *network.Server, loss float64) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lossy := &lossyPacketConn{PacketConn: pc, rng: rand.New(rand.NewSource(1)), loss: loss}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = srv.ServeUDP(ctx, lossy)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return "udp://" + pc.LocalAddr().String()
+}
+
+func TestUDP_ReliableResultsArriveInOrderDespiteLoss(t *testing.T) {
+	_, srv := startServer(t)
+	addr := startUDP(t, srv, 0.3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make(chan network.CommandResult, 64)
+	cl := newClientWith(addr, "diver", network.ClientHandlers{
+		Result: func(r network.CommandResult) { results <- r },
+	})
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 30
+	if _, err := cl.Request(command.DTO{Type: command.SPAWN}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < requests; i++ {
+		if _, err := cl.Request(command.DTO{Type: command.MOVE, Data: map[string]interface{}{"dx": 1.0, "dy": 0.0}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timeout := time.After(10 * time.Second)
+	for want := uint64(1); want <= requests; want++ {
+		select {
+		case r := <-results:
+			if r.RequestID != want {
+				t.Fatalf("result %d arrived when %d was expected", r.RequestID, want)
+			}
+			if !r.OK() {
+				t.Fatalf("request %d failed: %s", r.RequestID, r.Message)
+			}
+		case <-timeout:
+			t.Fatalf("only %d of %d results arrived", want-1, requests)
+		}
+	}
+}
+
+func TestUDP_ChatFromUDPReachesTCPInOrder(t *testing.T) {
+	cfg := network.DefaultServerConfig("")
+	cfg.ChatRate = network.RateLimit{} // the lines test reliability, not the chat limit
+	tcpAddr, srv := startServerWith(t, cfg, domain.NewWorld(800, 800))
+	udpAddr := startUDP(t, srv, 0.2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chat := make(chan network.ChatMessage, 64)
+	listener := newClientWith(tcpAddr, "ear", network.ClientHandlers{
+		Chat: func(m network.ChatMessage) { chat <- m },
+	})
+	if err := listener.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	talker := newClient(udpAddr, "mouth")
+	if err := talker.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	const lines = 40
+	for i := 0; i < lines; i++ {
+		if err := talker.SendChat(fmt.Sprintf("line %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	timeout := time.After(10 * time.Second)
+	for i := 0; i < lines; i++ {
+		select {
+		case m := <-chat:
+			if want := fmt.Sprintf("line %d", i); m.Text != want || m.From != "mouth" {
+				t.Fatalf("got %q from %s, want %q", m.Text, m.From, want)
+			}
+		case <-timeout:
+			t.Fatalf("only %d of %d lines arrived", i, lines)
+		}
+	}
+}
+
+func TestUDP_SnapshotsFlowDespiteLoss(t *testing.T) {
+	_, srv := startServer(t)
+	addr := startUDP(t, srv, 0.3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cl, snapshots := snapshotClient(addr, "floater")
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = cl.SendCommand(command.DTO{Type: command.SPAWN})
+	waitForCharacter(t, snapshots, "floater")
+
+	received := 0
+	timeout := time.After(2 * time.Second)
+	for received < 10 {
+		select {
+		case <-snapshots:
+			received++
+		case <-timeout:
+			t.Fatalf("only %d snapshots in 2s over a lossy link", received)
+		}
+	}
+}
+
+func TestUDP_StopSurvivesLoss(t *testing.T) {
+	_, srv := startServer(t)
+	addr := startUDP(t, srv, 0.3)
+
+	cl, snaps := snapshotClient(addr, "stopper")
+	if err := cl.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	_ = cl.SendCommand(command.DTO{Type: command.SPAWN, CharacterID: "stopper", Data: map[string]interface{}{}})
+	for range 5 {
+		_, _ = cl.SendInput(command.DTO{Type: command.MOVE, CharacterID: "stopper", Data: map[string]interface{}{"dx": 1.0, "dy": 0.0}})
+	}
+	stop, err := cl.SendReliableInput(command.DTO{Type: command.MOVE, CharacterID: "stopper", Data: map[string]interface{}{"dx": 0.0, "dy": 0.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.After(10 * time.Second)
+	for {
+		select {
+		case ws := <-snaps:
+			if ws.LastInputSeq < stop {
+				continue
+			}
+			for _, c := range ws.Characters {
+				if c.ID == "stopper" && c.State == "running" {
+					t.Fatalf("still running after the stop was acknowledged")
+				}
+			}
+			return
+		case <-deadline:
+			t.Fatal("the stop was never acknowledged")
+		}
+	}
+}
+
+// Datagram kinds of the UDP transport.
+const (
+	udpReliableKind = 1
+	udpHelloKind    = 5
+	udpCookieKind   = 6
+	udpOpenKind     = 7
+)
+
+// rawUDP sends each packet to the listener at addr from a fresh socket and
+// returns whatever comes back within a short wait.
+func rawUDP(t *testing.T, addr string, packets ...[]byte) [][]byte {
+	t.Helper()
+	conn, err := net.Dial("udp", strings.TrimPrefix(addr, "udp://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, p := range packets {
+		if _, err := conn.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got [][]byte
+	buf := make([]byte, 2048)
+	_ = conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return got
+		}
+		got = append(got, append([]byte(nil), buf[:n]...))
+	}
+}
+
+func TestUDP_OpensConnectionsOnlyWithCookie(t *testing.T) {
+	_, srv := startServer(t)
+	addr := startUDP(t, srv, 0)
+
+	hello, _ := json.Marshal(network.Hello{Version: network.ProtocolVersion, CharacterID: "spoofed"})
+	plain := append([]byte{udpReliableKind, 1}, hello...)
+	forged := append(append([]byte{udpOpenKind}, make([]byte, 24)...), plain[1:]...)
+	if got := rawUDP(t, addr, plain, forged); len(got) != 0 {
+		t.Fatalf("listener answered %d packets opened without a valid cookie", len(got))
+	}
+
+	if got := rawUDP(t, addr, []byte{udpHelloKind}); len(got) != 0 {
+		t.Fatal("listener answered an unpadded cookie request")
+	}
+	request := make([]byte, 64)
+	request[0] = udpHelloKind
+	got := rawUDP(t, addr, request)
+	if len(got) != 1 || got[0][0] != udpCookieKind {
+		t.Fatalf("got %d packets, want one cookie", len(got))
+	}
+	if len(got[0]) > len(request) {
+		t.Errorf("cookie of %d bytes answers a %d byte request", len(got[0]), len(request))
+	}
+}
@@ -0,0 +1,173 @@
+package infrastructure
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"meatgrinder/internal/application/command"
+	"meatgrinder/internal/application/services"
+	"meatgrinder/internal/infrastructure/network"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startWebSocket serves srv over WebSocket as well and returns the URL.
+func startWebSocket(t *testing.T, srv *network.Server) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = srv.ServeWebSocket(ctx, ln)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return "ws://" + ln.Addr().String() + "/ws"
+}
+
+func TestWebSocket_PlaysAlongsideTCP(t *testing.T) {
+	for _, codec := range []string{"json", "binary"} {
+		t.Run(codec, func(t *testing.T) {
+			addr, srv := startServer(t)
+			wsURL := startWebSocket(t, srv)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			results := make(chan network.CommandResult, 1)
+			cfg := network.DefaultClientConfig(wsURL)
+			cfg.CharacterID = "surfer"
+			cfg.Codecs = []string{codec}
+			webby := network.NewClient(cfg, network.ClientHandlers{
+				Result: func(r network.CommandResult) { results <- r },
+			})
+			if err := webby.Connect(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if webby.CodecName() != codec {
+				t.Fatalf("negotiated %q, want %q", webby.CodecName(), codec)
+			}
+			if _, err := webby.Request(command.DTO{Type: command.SPAWN}); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case r := <-results:
+				if !r.OK() {
+					t.Fatalf("spawn over websocket failed: %s", r.Message)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("no result for the spawn command")
+			}
+
+			watcher, snapshots := snapshotClient(addr, "watcher")
+			if err := watcher.Connect(ctx); err != nil {
+				t.Fatal(err)
+			}
+			waitForCharacter(t, snapshots, "surfer")
+		})
+	}
+}
+
+func TestWebSocket_ReceivesSnapshots(t *testing.T) {
+	_, srv := startServer(t)
+	wsURL := startWebSocket(t, srv)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	snapshots := make(chan services.WorldSnapshot, 16)
+	cfg := network.DefaultClientConfig(wsURL)
+	cfg.CharacterID = "viewer"
+	cl := network.NewClient(cfg, network.ClientHandlers{
+		Snapshot: func(ws services.WorldSnapshot) {
+			select {
+			case snapshots <- ws:
+			default:
+			}
+		},
+	})
+	if err := cl.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_ = cl.SendCommand(command.DTO{Type: command.SPAWN})
+	waitForCharacter(t, snapshots, "viewer")
+}
+
+func TestWebSocket_RejectsPlainHTTP(t *testing.T) {
+	_, srv := startServer(t)
+	wsURL := startWebSocket(t, srv)
+
+	resp, err := http.Get("http" + wsURL[len("ws"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusUpgradeRequired)
+	}
+}
+
+// A browser sends the JSON Hello as a masked text frame and expects text
+// frames back while the JSON codec is in use.
+func TestWebSocket_SpeaksTextFramesToBrowsers(t *testing.T) {
+	_, srv := startServer(t)
+	wsURL := startWebSocket(t, srv)
+
+	conn, err := net.Dial("tcp", wsURL[len("ws://"):len(wsURL)-len("/ws")])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	req := "GET /ws HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", got)
+	}
+
+	hello, _ := json.Marshal(network.Hello{Version: network.ProtocolVersion, CharacterID: "browser", Codecs: []string{"json"}})
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x81, 0x80 | byte(len(hello))}
+	frame = append(frame, mask[:]...)
+	for i, b := range hello {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+
+	var h [2]byte
+	if _, err := io.ReadFull(br, h[:]); err != nil {
+		t.Fatal(err)
+	}
+	if h[0] != 0x81 {
+		t.Fatalf("first frame header %#x, want a final text frame", h[0])
+	}
+	payload := make([]byte, h[1]&0x7F)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	var w network.Welcome
+	if err := json.Unmarshal(payload, &w); err != nil || w.CharacterID != "browser" {
+		t.Fatalf("welcome %+v, err %v", w, err)
+	}
+}